@@ -0,0 +1,203 @@
+package asset
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dulumao/Guten-framework/app/core/env"
+)
+
+// fingerprintPattern matches the files written by Build, e.g.
+// "css/app.3f2a1b9c.css".
+var fingerprintPattern = regexp.MustCompile(`\.[0-9a-f]{8}(\.[^./]+)?$`)
+
+// Manifest maps the names of assets to their fingerprinted files. It reads
+// the manifests written by Build and webpack-manifest-plugin, name to file,
+// and the manifests of Vite, name to an object with the file.
+type Manifest struct {
+	mutex sync.RWMutex
+
+	// Prefix is the URL path the files are served under, e.g. "/static".
+	Prefix string
+
+	files map[string]string
+	// fingerprinted files, relative to the prefix
+	fingerprinted map[string]bool
+	// loaded is set once a manifest was loaded or an entry set
+	loaded bool
+}
+
+// Default is the manifest of the asset() template function, configured by New.
+var Default = NewManifest("/static")
+
+func NewManifest(prefix string) *Manifest {
+	return &Manifest{
+		Prefix:        strings.TrimRight(prefix, "/"),
+		files:         make(map[string]string),
+		fingerprinted: make(map[string]bool),
+	}
+}
+
+// New configures Default from env.toml and loads its manifest if it was
+// built, without a manifest assets are served under their own names.
+func New() error {
+	Default = NewManifest(Prefix())
+
+	if _, err := os.Stat(ManifestFile()); os.IsNotExist(err) {
+		return nil
+	}
+
+	return Default.Load(ManifestFile())
+}
+
+// Dir returns the directory of the assets, "web/assets/static" by default.
+func Dir() string {
+	if env.Value != nil && env.Value.Asset.Dir != "" {
+		return env.Value.Asset.Dir
+	}
+
+	return "web/assets/static"
+}
+
+// Prefix returns the URL path of the assets, "/static" by default.
+func Prefix() string {
+	if env.Value != nil && env.Value.Asset.Prefix != "" {
+		return strings.TrimRight(env.Value.Asset.Prefix, "/")
+	}
+
+	return "/static"
+}
+
+// ManifestFile returns the manifest, "manifest.json" in Dir by default.
+func ManifestFile() string {
+	if env.Value != nil && env.Value.Asset.Manifest != "" {
+		return env.Value.Asset.Manifest
+	}
+
+	return filepath.Join(Dir(), "manifest.json")
+}
+
+// Load adds the entries of a manifest file.
+func (self *Manifest) Load(file string) error {
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	var entries map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	self.loaded = true
+	self.mutex.Unlock()
+
+	for name, raw := range entries {
+		var file string
+
+		if err := json.Unmarshal(raw, &file); err != nil {
+			// Vite: {"src/main.js": {"file": "assets/main-4f2a9c1d.js", ...}}
+			var entry struct {
+				File string `json:"file"`
+			}
+
+			if err := json.Unmarshal(raw, &entry); err != nil || entry.File == "" {
+				continue
+			}
+
+			file = entry.File
+		}
+
+		self.Set(name, file)
+	}
+
+	return nil
+}
+
+// Set maps the name to a file relative to the prefix, or to an absolute
+// path or URL which is used as is.
+func (self *Manifest) Set(name, file string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	name = strings.TrimPrefix(name, "/")
+	self.files[name] = file
+	self.loaded = true
+
+	// the build tools rename the files they fingerprint
+	if relative := strings.TrimPrefix(file, self.Prefix+"/"); !isAbsolute(relative) && relative != name {
+		self.fingerprinted[relative] = true
+	}
+}
+
+// Files returns the entries of the manifest.
+func (self *Manifest) Files() map[string]string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var files = make(map[string]string, len(self.files))
+
+	for name, file := range self.files {
+		files[name] = file
+	}
+
+	return files
+}
+
+// URL returns the URL of the fingerprinted file of the asset, assets
+// missing from the manifest keep their name.
+func (self *Manifest) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+
+	self.mutex.RLock()
+	file, ok := self.files[name]
+	self.mutex.RUnlock()
+
+	if !ok {
+		file = name
+	}
+
+	if isAbsolute(file) {
+		return file
+	}
+
+	return self.Prefix + "/" + file
+}
+
+// IsFingerprinted reports whether the file, relative to the prefix, changes
+// its name when its content changes and can be cached forever. With a
+// manifest only its files are, a name that merely looks fingerprinted, e.g.
+// "deadbeef.js", is not. Without one the names written by Build are.
+func (self *Manifest) IsFingerprinted(file string) bool {
+	file = strings.TrimPrefix(path.Clean("/"+file), "/")
+
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if self.loaded {
+		return self.fingerprinted[file]
+	}
+
+	return fingerprintPattern.MatchString(file)
+}
+
+// URL returns the URL of the asset in the Default manifest, it is the
+// asset() function of the templates:
+//
+//	<link rel="stylesheet" href="{{ asset("css/app.css") }}">
+func URL(name string) string {
+	return Default.URL(name)
+}
+
+func isAbsolute(file string) bool {
+	return strings.HasPrefix(file, "/") || strings.Contains(file, "://")
+}
@@ -0,0 +1,130 @@
+package asset
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asset")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "css", "app.css"), []byte("body { color: red }"), 0644)
+
+	manifestFile := filepath.Join(dir, "manifest.json")
+	files, err := Build(dir, manifestFile, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprinted := files["css/app.css"]
+
+	if !fingerprintPattern.MatchString(fingerprinted) {
+		t.Fatalf("css/app.css is built to %q", fingerprinted)
+	}
+
+	// a second build skips the files of the first one
+	if files, err := Build(dir, manifestFile, true); err != nil || len(files) != 1 {
+		t.Fatalf("second build: %v, %v", files, err)
+	}
+
+	manifest := NewManifest("/static")
+
+	if err := manifest.Load(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if url := manifest.URL("css/app.css"); url != "/static/"+fingerprinted {
+		t.Errorf("URL = %q", url)
+	}
+
+	if url := manifest.URL("img/logo.png"); url != "/static/img/logo.png" {
+		t.Errorf("URL of a missing asset = %q", url)
+	}
+
+	e := echo.New()
+	e.GET("/static/*", Handler(dir, manifest))
+
+	for _, test := range []struct {
+		path, acceptEncoding   string
+		cacheControl, encoding string
+	}{
+		{"/static/" + fingerprinted, "gzip, br", ImmutableCacheControl, "gzip"},
+		{"/static/" + fingerprinted, "", ImmutableCacheControl, ""},
+		{"/static/css/app.css", "gzip", "", ""},
+	} {
+		req := httptest.NewRequest(echo.GET, test.path, nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, test.acceptEncoding)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d", test.path, rec.Code)
+		}
+
+		if rec.Header().Get("Cache-Control") != test.cacheControl || rec.Header().Get(echo.HeaderContentEncoding) != test.encoding {
+			t.Errorf("%s %q: Cache-Control %q, Content-Encoding %q", test.path, test.acceptEncoding, rec.Header().Get("Cache-Control"), rec.Header().Get(echo.HeaderContentEncoding))
+		}
+
+		if rec.Header().Get(echo.HeaderContentType) != "text/css; charset=utf-8" {
+			t.Errorf("%s: Content-Type %q", test.path, rec.Header().Get(echo.HeaderContentType))
+		}
+	}
+
+	req := httptest.NewRequest(echo.GET, "/static/../manifest.json/../../etc/passwd", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("path traversal: status %d", rec.Code)
+	}
+}
+
+func TestManifest_LoadVite(t *testing.T) {
+	f, err := ioutil.TempFile("", "manifest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"src/main.js": {"file": "assets/main-4f2a9c1d.js", "isEntry": true}, "logo.svg": "https://cdn.example.com/logo.svg"}`)
+	f.Close()
+
+	manifest := NewManifest("/build/")
+
+	if err := manifest.Load(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	if url := manifest.URL("src/main.js"); url != "/build/assets/main-4f2a9c1d.js" {
+		t.Errorf("URL = %q", url)
+	}
+
+	if url := manifest.URL("logo.svg"); url != "https://cdn.example.com/logo.svg" {
+		t.Errorf("URL = %q", url)
+	}
+
+	if !manifest.IsFingerprinted("assets/main-4f2a9c1d.js") || manifest.IsFingerprinted("src/main.js") {
+		t.Error("IsFingerprinted of the Vite entry")
+	}
+
+	// only the files of a loaded manifest are, whatever their name
+	if manifest.IsFingerprinted("js/deadbeef.js") || !NewManifest("/build").IsFingerprinted("js/app.deadbeef.js") {
+		t.Error("IsFingerprinted of a file missing from the manifest")
+	}
+}
@@ -0,0 +1,25 @@
+// assetctl fingerprints the assets configured in env.toml.
+//
+//	assetctl build
+//	assetctl list
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/asset"
+	"github.com/dulumao/Guten-framework/app/core/env"
+)
+
+func main() {
+	if err := env.New(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := asset.RunCommand(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,214 @@
+package asset
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dulumao/Guten-framework/app/core/env"
+)
+
+// Compressible are the extensions Build writes a .gz variant for. Build does
+// not write .br variants, the standard library has no brotli encoder.
+var Compressible = []string{".css", ".js", ".mjs", ".json", ".svg", ".html", ".xml", ".txt", ".map", ".wasm"}
+
+// Build copies every file of dir to a name with the hash of its content,
+// "css/app.css" to "css/app.3f2a1b9c.css", and writes the manifest. With
+// compress the copies of Compressible files get a .gz variant only. Build
+// writes no .br variants, those written next to the copies by other tools,
+// e.g. "brotli -k", are served to clients accepting br.
+//
+// Files of previous builds are kept, pages cached by clients may still
+// refer to them.
+func Build(dir, manifestFile string, compress bool) (map[string]string, error) {
+	var manifest = make(map[string]string)
+	var manifestPath, _ = filepath.Abs(manifestFile)
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || isVariant(file) || fingerprintPattern.MatchString(file) {
+			return nil
+		}
+
+		if abs, _ := filepath.Abs(file); abs == manifestPath {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, file)
+
+		if err != nil {
+			return err
+		}
+
+		hash, err := hashFile(file)
+
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+		ext := path.Ext(name)
+		fingerprinted := strings.TrimSuffix(name, ext) + "." + hash + ext
+		target := filepath.Join(dir, filepath.FromSlash(fingerprinted))
+
+		if err := copyFile(file, target, info.Mode()); err != nil {
+			return err
+		}
+
+		if compress && isCompressible(ext) {
+			if err := gzipFile(target); err != nil {
+				return err
+			}
+		}
+
+		manifest[name] = fingerprinted
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, ioutil.WriteFile(manifestFile, data, 0644)
+}
+
+// RunCommand runs a command of assetctl:
+//
+//	build  fingerprints the assets and writes the manifest
+//	list   prints the entries of the manifest
+func RunCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: build | list")
+	}
+
+	switch args[0] {
+	case "build":
+		manifest, err := Build(Dir(), ManifestFile(), env.Value != nil && env.Value.Asset.Compress)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(out, "%d assets written to %s\n", len(manifest), ManifestFile())
+
+		return err
+	case "list":
+		if err := New(); err != nil {
+			return err
+		}
+
+		var files = Default.Files()
+		var names = make([]string, 0, len(files))
+
+		for name := range files {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(out, "%s\t%s\n", name, files[name])
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("asset: unknown command %q", args[0])
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	var hash = sha256.New()
+
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:8], nil
+}
+
+func copyFile(source, target string, mode os.FileMode) error {
+	data, err := ioutil.ReadFile(source)
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(target, data, mode)
+}
+
+func gzipFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(file + ".gz")
+
+	if err != nil {
+		return err
+	}
+
+	w, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+
+	if _, err := w.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func isCompressible(ext string) bool {
+	for _, compressible := range Compressible {
+		if ext == compressible {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isVariant reports whether the file is a precompressed variant.
+func isVariant(file string) bool {
+	for _, encoding := range encodings {
+		if strings.HasSuffix(file, encoding.ext) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package asset
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// ImmutableCacheControl is sent with fingerprinted files.
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// encodings of the precompressed variants, in order of preference.
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Handler serves the files of root, registered under the prefix of the
+// manifest with a "/*" parameter. Fingerprinted files are cached forever
+// and precompressed .br and .gz variants are sent to clients accepting them.
+func Handler(root string, manifest *Manifest) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name, err := url.PathUnescape(c.Param("*"))
+
+		if err != nil {
+			return echo.ErrNotFound
+		}
+
+		name = path.Clean("/" + name)
+		file := filepath.Join(root, filepath.FromSlash(name))
+		info, err := os.Stat(file)
+
+		if err != nil || info.IsDir() {
+			return echo.ErrNotFound
+		}
+
+		var header = c.Response().Header()
+
+		if manifest.IsFingerprinted(name) {
+			header.Set("Cache-Control", ImmutableCacheControl)
+		}
+
+		header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+		if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+			header.Set(echo.HeaderContentType, contentType)
+		}
+
+		for _, encoding := range encodings {
+			if !acceptsEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding), encoding.name) {
+				continue
+			}
+
+			if variant, err := os.Stat(file + encoding.ext); err == nil && !variant.IsDir() {
+				header.Set(echo.HeaderContentEncoding, encoding.name)
+				file, info = file+encoding.ext, variant
+
+				break
+			}
+		}
+
+		f, err := os.Open(file)
+
+		if err != nil {
+			return echo.ErrNotFound
+		}
+
+		defer f.Close()
+
+		http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), f)
+
+		return nil
+	}
+}
+
+// Static registers the Handler of the Default manifest for the assets of
+// env.toml.
+func Static(app *echo.Echo) {
+	app.GET(Default.Prefix+"/*", Handler(Dir(), Default))
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		var fields = strings.Split(part, ";")
+
+		if strings.TrimSpace(fields[0]) != encoding {
+			continue
+		}
+
+		for _, param := range fields[1:] {
+			if q := strings.Replace(param, " ", "", -1); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
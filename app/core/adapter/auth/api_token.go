@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/database"
+	"github.com/dulumao/Guten-utils/conv"
+)
+
+// ApiToken is an opaque personal access token. Only the SHA-256 of the token
+// is stored, the plain token is shown to the user once when it is created.
+type ApiToken struct {
+	Id         uint   `gorm:"primary_key"`
+	UserId     string `gorm:"size:64;index"`
+	Name       string `gorm:"size:191"`
+	Token      string `gorm:"size:64;unique_index"`
+	Scopes     string `gorm:"type:text"`
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (self *ApiToken) TableName() string {
+	return "api_tokens"
+}
+
+func (self *ApiToken) isExpired() bool {
+	return self.ExpiresAt != nil && time.Now().After(*self.ExpiresAt)
+}
+
+// GetScopes returns the scopes granted to the token.
+func (self *ApiToken) GetScopes() []string {
+	if self.Scopes == "" {
+		return nil
+	}
+
+	return strings.Split(self.Scopes, " ")
+}
+
+// HasScope reports whether the token grants the scope. The "*" scope grants all.
+func (self *ApiToken) HasScope(scope string) bool {
+	return hasScope(self.GetScopes(), scope)
+}
+
+// IApiTokenRepository stores api tokens.
+type IApiTokenRepository interface {
+	Create(token *ApiToken) error
+	// FindByHash returns the token with the given SHA-256 hex digest.
+	FindByHash(hash string) (*ApiToken, error)
+	Delete(id uint) error
+	DeleteByUser(userId string) error
+	Touch(token *ApiToken) error
+}
+
+var (
+	apiTokenMutex      sync.RWMutex
+	apiTokenRepository IApiTokenRepository = new(GormApiTokenRepository)
+)
+
+// SetApiTokenRepository sets where api tokens are stored.
+func SetApiTokenRepository(repository IApiTokenRepository) {
+	apiTokenMutex.Lock()
+	apiTokenRepository = repository
+	apiTokenMutex.Unlock()
+}
+
+func GetApiTokenRepository() IApiTokenRepository {
+	apiTokenMutex.RLock()
+	defer apiTokenMutex.RUnlock()
+
+	return apiTokenRepository
+}
+
+// CreateApiToken stores a new token for the user and returns the plain token.
+// A ttl of 0 creates a token that does not expire.
+func CreateApiToken(user IUser, name string, scopes []string, ttl time.Duration) (string, *ApiToken, error) {
+	plain, err := randomString(30)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &ApiToken{
+		UserId: conv.String(user.GetId()),
+		Name:   name,
+		Token:  hashToken(plain),
+		Scopes: strings.Join(scopes, " "),
+	}
+
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := GetApiTokenRepository().Create(token); err != nil {
+		return "", nil, err
+	}
+
+	return plain, token, nil
+}
+
+// FindApiToken returns the stored token for the plain token if it has not expired.
+func FindApiToken(plain string) (*ApiToken, error) {
+	token, err := GetApiTokenRepository().FindByHash(hashToken(plain))
+
+	if err != nil || token == nil || token.isExpired() {
+		return nil, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// GormApiTokenRepository stores api tokens in the api_tokens table.
+type GormApiTokenRepository struct{}
+
+func (self *GormApiTokenRepository) Create(token *ApiToken) error {
+	return database.DB.Create(token).Error
+}
+
+func (self *GormApiTokenRepository) FindByHash(hash string) (*ApiToken, error) {
+	var token = new(ApiToken)
+
+	if err := database.DB.Where("token = ?", hash).First(token).Error; err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (self *GormApiTokenRepository) Delete(id uint) error {
+	return database.DB.Where("id = ?", id).Delete(ApiToken{}).Error
+}
+
+func (self *GormApiTokenRepository) DeleteByUser(userId string) error {
+	return database.DB.Where("user_id = ?", userId).Delete(ApiToken{}).Error
+}
+
+func (self *GormApiTokenRepository) Touch(token *ApiToken) error {
+	return database.DB.Model(token).UpdateColumn("last_used_at", time.Now()).Error
+}
+
+// MemoryApiTokenRepository keeps api tokens in memory, for tests.
+type MemoryApiTokenRepository struct {
+	mutex  sync.RWMutex
+	lastId uint
+	tokens map[uint]ApiToken
+}
+
+func NewMemoryApiTokenRepository() *MemoryApiTokenRepository {
+	return &MemoryApiTokenRepository{tokens: make(map[uint]ApiToken)}
+}
+
+func (self *MemoryApiTokenRepository) Create(token *ApiToken) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.lastId++
+	token.Id = self.lastId
+	token.CreatedAt = time.Now()
+	self.tokens[token.Id] = *token
+
+	return nil
+}
+
+func (self *MemoryApiTokenRepository) FindByHash(hash string) (*ApiToken, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	for _, token := range self.tokens {
+		if token.Token == hash {
+			return &token, nil
+		}
+	}
+
+	return nil, ErrInvalidToken
+}
+
+func (self *MemoryApiTokenRepository) Delete(id uint) error {
+	self.mutex.Lock()
+	delete(self.tokens, id)
+	self.mutex.Unlock()
+
+	return nil
+}
+
+func (self *MemoryApiTokenRepository) DeleteByUser(userId string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for id, token := range self.tokens {
+		if token.UserId == userId {
+			delete(self.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (self *MemoryApiTokenRepository) Touch(token *ApiToken) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if stored, ok := self.tokens[token.Id]; ok {
+		now := time.Now()
+		stored.LastUsedAt = &now
+		self.tokens[token.Id] = stored
+	}
+
+	return nil
+}
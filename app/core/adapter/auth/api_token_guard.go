@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"github.com/labstack/echo"
+)
+
+// ApiTokenGuard authenticates requests with an opaque bearer token created
+// by CreateApiToken.
+type ApiTokenGuard struct {
+	name     string
+	provider IUserProvider
+	context  echo.Context
+	user     IUser
+	token    *ApiToken
+	resolved bool
+}
+
+func NewApiTokenGuard(name string, provider IUserProvider, context echo.Context) *ApiTokenGuard {
+	return &ApiTokenGuard{
+		name:     name,
+		provider: provider,
+		context:  context,
+	}
+}
+
+func (self *ApiTokenGuard) Name() string {
+	return self.name
+}
+
+func (self *ApiTokenGuard) Check() bool {
+	return self.User() != nil
+}
+
+func (self *ApiTokenGuard) Guest() bool {
+	return !self.Check()
+}
+
+func (self *ApiTokenGuard) User() IUser {
+	if self.resolved {
+		return self.user
+	}
+
+	self.resolved = true
+
+	plain := bearerToken(self.context)
+
+	if plain == "" {
+		return nil
+	}
+
+	token, err := FindApiToken(plain)
+
+	if err != nil {
+		return nil
+	}
+
+	if user, err := self.provider.RetrieveById(token.UserId); err == nil && user != nil {
+		self.user = user
+		self.token = token
+
+		GetApiTokenRepository().Touch(token)
+	}
+
+	return self.user
+}
+
+func (self *ApiTokenGuard) ID() interface{} {
+	if user := self.User(); user != nil {
+		return user.GetId()
+	}
+
+	return nil
+}
+
+// Token returns the api token of the request, or nil.
+func (self *ApiTokenGuard) Token() *ApiToken {
+	self.User()
+
+	return self.token
+}
+
+func (self *ApiTokenGuard) HasScope(scope string) bool {
+	if token := self.Token(); token != nil {
+		return token.HasScope(scope)
+	}
+
+	return false
+}
+
+func (self *ApiTokenGuard) Validate(credentials Credentials) bool {
+	_, err := attempt(self.provider, credentials)
+
+	return err == nil
+}
+
+// Attempt checks the credentials and sets the user for the current request,
+// use CreateApiToken to hand a token to the client.
+func (self *ApiTokenGuard) Attempt(credentials Credentials) error {
+	user, err := attempt(self.provider, credentials)
+
+	if err != nil {
+		return err
+	}
+
+	return self.Login(user)
+}
+
+// Login sets the user for the current request only.
+func (self *ApiTokenGuard) Login(user IUser) error {
+	self.user = user
+	self.token = nil
+	self.resolved = true
+
+	return nil
+}
+
+// Logout revokes the token the request was authenticated with.
+func (self *ApiTokenGuard) Logout() error {
+	var err error
+
+	if token := self.Token(); token != nil {
+		err = GetApiTokenRepository().Delete(token.Id)
+	}
+
+	self.user = nil
+	self.token = nil
+	self.resolved = true
+
+	return err
+}
+
+// Challenge tells the client to send a bearer token.
+func (self *ApiTokenGuard) Challenge() {
+	self.context.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+}
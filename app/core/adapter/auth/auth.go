@@ -1,59 +1,203 @@
 package auth
 
 import (
-	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"errors"
+
 	"github.com/labstack/echo"
 )
 
-type IAuth interface {
+const (
+	DefaultKey = "AUTH"
+
+	// PasswordKey is the credentials key holding the plain text password.
+	PasswordKey = "password"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+	ErrUnknownGuard       = errors.New("auth: unknown guard")
+	ErrNoSession          = errors.New("auth: the session middleware is not used")
+)
+
+// IUser is implemented by models that can be authenticated.
+type IUser interface {
+	// GetId returns the value stored in the session to identify the user.
 	GetId() interface{}
-	GetUserName() string
-	GetGuard() string
-	GetUser(interface{})
+	// GetPassword returns the stored password of the user.
+	GetPassword() string
 }
 
+// Credentials are the values a user logs in with, keyed by column name,
+// e.g. {"email": "a@b.c", "password": "secret"}.
+type Credentials map[string]string
+
+// AuthManager resolves the guards of a request. The manager and the guards
+// it creates live for the duration of one request, so users are only looked
+// up once per request and guard.
 type AuthManager struct {
-	Session session.ISession
+	context      echo.Context
+	defaultGuard string
+	guards       map[string]IGuard
 }
 
 func New() *AuthManager {
-	return new(AuthManager)
+	return &AuthManager{
+		defaultGuard: getDefaultGuard(),
+		guards:       make(map[string]IGuard),
+	}
 }
 
-func (self *AuthManager) SetAttempt(auth IAuth) bool {
-	self.Session.Set("auth_"+auth.GetGuard(), auth.GetId())
+func (self *AuthManager) SetContext(context echo.Context) *AuthManager {
+	self.context = context
 
-	if err := self.Session.Save(); err != nil {
-		panic(err)
-		return false
+	return self
+}
+
+// Guard returns the named guard, or the default guard if no name is given.
+// It returns nil when the guard was not registered with RegisterGuard, the
+// methods of the manager then act as for a guest and return ErrUnknownGuard.
+func (self *AuthManager) Guard(name ...string) IGuard {
+	var guardName = self.defaultGuard
+
+	if len(name) > 0 && name[0] != "" {
+		guardName = name[0]
 	}
 
-	return true
-}
+	if guard, ok := self.guards[guardName]; ok {
+		return guard
+	}
+
+	driver, ok := getGuardDriver(guardName)
+
+	if !ok {
+		return nil
+	}
 
-func (self AuthManager) SetContext(context echo.Context) *AuthManager {
-	self.Session = session.Default(context)
+	guard := driver(guardName, self.context)
+	self.guards[guardName] = guard
 
-	return &self
+	return guard
 }
 
-func (self *AuthManager) Guest(auth IAuth) bool {
-	uid := self.Session.Get("auth_" + auth.GetGuard())
+// HasGuard reports whether the named guard, or the default guard if no name
+// is given, was registered, so Guard does not return nil.
+func (self *AuthManager) HasGuard(name ...string) bool {
+	var guardName = self.defaultGuard
 
-	if uid == nil {
+	if len(name) > 0 && name[0] != "" {
+		guardName = name[0]
+	}
+
+	if _, ok := self.guards[guardName]; ok {
 		return true
 	}
 
+	_, ok := getGuardDriver(guardName)
+
+	return ok
+}
+
+// ShouldUse changes the default guard for the rest of the request.
+func (self *AuthManager) ShouldUse(name string) {
+	self.defaultGuard = name
+}
+
+func (self *AuthManager) Check() bool {
+	if guard := self.Guard(); guard != nil {
+		return guard.Check()
+	}
+
+	return false
+}
+
+func (self *AuthManager) Guest() bool {
+	return !self.Check()
+}
+
+func (self *AuthManager) User() IUser {
+	if guard := self.Guard(); guard != nil {
+		return guard.User()
+	}
+
+	return nil
+}
+
+func (self *AuthManager) ID() interface{} {
+	if guard := self.Guard(); guard != nil {
+		return guard.ID()
+	}
+
+	return nil
+}
+
+func (self *AuthManager) Validate(credentials Credentials) bool {
+	if guard := self.Guard(); guard != nil {
+		return guard.Validate(credentials)
+	}
+
 	return false
 }
 
-func (self *AuthManager) User(auth IAuth) {
-	uid := self.Session.Get("auth_" + auth.GetGuard())
+// Attempt logs in with the credentials. Failed attempts are counted per
+// username and IP, see MaxAttempts.
+func (self *AuthManager) Attempt(credentials Credentials) error {
+	guard := self.Guard()
+
+	if guard == nil {
+		return ErrUnknownGuard
+	}
+
+	return self.throttled(credentials, func() error {
+		return guard.Attempt(credentials)
+	})
+}
+
+// AttemptRemember logs in with a remember me cookie if the guard supports it.
+func (self *AuthManager) AttemptRemember(credentials Credentials) error {
+	guard, ok := self.Guard().(IRememberGuard)
+
+	if !ok {
+		return self.Attempt(credentials)
+	}
 
-	auth.GetUser(uid)
+	return self.throttled(credentials, func() error {
+		return guard.AttemptRemember(credentials)
+	})
 }
 
-func (self AuthManager) Logout(auth IAuth) {
-	self.Session.Delete("auth_" + auth.GetGuard())
-	self.Session.Save()
+func (self *AuthManager) Login(user IUser) error {
+	if guard := self.Guard(); guard != nil {
+		return guard.Login(user)
+	}
+
+	return ErrUnknownGuard
+}
+
+func (self *AuthManager) Logout() error {
+	if guard := self.Guard(); guard != nil {
+		return guard.Logout()
+	}
+
+	return ErrUnknownGuard
+}
+
+// LogoutEverywhere also revokes the remember me tokens of all devices.
+func (self *AuthManager) LogoutEverywhere() error {
+	if guard, ok := self.Guard().(IRememberGuard); ok {
+		return guard.LogoutEverywhere()
+	}
+
+	return self.Logout()
+}
+
+// shortcut to get the auth manager of the request
+func Default(context echo.Context) *AuthManager {
+	if manager, ok := context.Get(DefaultKey).(*AuthManager); ok {
+		return manager
+	}
+
+	manager := New().SetContext(context)
+	context.Set(DefaultKey, manager)
+
+	return manager
 }
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	utilsCache "github.com/dulumao/Guten-utils/os/cache"
+	"github.com/dulumao/Guten-utils/os/event"
+	"github.com/labstack/echo"
+)
+
+type testUser struct {
+	id       int
+	email    string
+	password string
+}
+
+func (self *testUser) GetId() interface{} {
+	return self.id
+}
+
+func (self *testUser) GetPassword() string {
+	return self.password
+}
+
+type testProvider struct {
+	users   []*testUser
+	lookups int
+}
+
+func (self *testProvider) RetrieveById(id interface{}) (IUser, error) {
+	self.lookups++
+
+	for _, user := range self.users {
+		if user.id == id {
+			return user, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+func (self *testProvider) RetrieveByCredentials(credentials Credentials) (IUser, error) {
+	for _, user := range self.users {
+		if user.email == credentials["email"] {
+			return user, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+func (self *testProvider) ValidateCredentials(user IUser, credentials Credentials) bool {
+	return user.GetPassword() == credentials[PasswordKey]
+}
+
+func newTestApp(store session.IMemoryStore, provider IUserProvider) *echo.Echo {
+	RegisterGuard("web", func(name string, c echo.Context) IGuard {
+		return NewSessionGuard(name, provider, c)
+	})
+	RegisterGuard("basic", func(name string, c echo.Context) IGuard {
+		return NewBasicGuard(name, provider, c)
+	})
+
+	app := echo.New()
+	app.Use(session.New("session", store))
+
+	return app
+}
+
+func TestSessionGuard(t *testing.T) {
+	store := session.NewMemoryStore([]byte("secret"))
+	provider := &testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: "secret"}}}
+	app := newTestApp(store, provider)
+
+	app.POST("/login", func(c echo.Context) error {
+		if err := Default(c).Attempt(Credentials{"email": "a@b.c", PasswordKey: "wrong"}); err != ErrInvalidCredentials {
+			t.Errorf("expect ErrInvalidCredentials, got %v", err)
+		}
+
+		return Default(c).Attempt(Credentials{"email": "a@b.c", PasswordKey: "secret"})
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", rec.Code)
+	}
+
+	ids := store.Sessions()
+
+	if len(ids) != 1 {
+		t.Fatalf("expect 1 session, got %d", len(ids))
+	}
+
+	if values, _ := store.Values(ids[0]); values["auth_web"] != 1 {
+		t.Errorf("expect auth_web 1, got %v", values["auth_web"])
+	}
+
+	app.GET("/me", func(c echo.Context) error {
+		manager := Default(c)
+
+		if !manager.Check() || manager.ID() != 1 || manager.User() == nil {
+			t.Error("expect user 1 to be logged in")
+		}
+
+		return nil
+	})
+
+	cookie, _ := store.Cookie("session", ids[0])
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(cookie)
+	provider.lookups = 0
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	if provider.lookups != 1 {
+		t.Errorf("expect user to be looked up once per request, got %d", provider.lookups)
+	}
+}
+
+func TestMiddleware_Basic(t *testing.T) {
+	store := session.NewMemoryStore([]byte("secret"))
+	provider := &testProvider{users: []*testUser{{id: 2, email: "a@b.c", password: "secret"}}}
+	app := newTestApp(store, provider)
+
+	app.GET("/api", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, Middleware("web", "basic"))
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expect 401, got %d", rec.Code)
+	}
+
+	if rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+		t.Error("expect basic auth challenge")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.SetBasicAuth("a@b.c", "secret")
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expect 200, got %d", rec.Code)
+	}
+}
+
+func TestAttempt_Throttle(t *testing.T) {
+	observer.New()
+	adapter, _ := utilsCache.NewCache("memory", `{"interval":0}`)
+	cache.Store = cache.NewRepository(adapter, cache.JSON)
+	defer func() { cache.Store = nil }()
+
+	var lockouts int
+
+	observer.Dispatcher.On(EventLockout, event.Listener{Callback: func(e *event.Event) error {
+		lockouts++
+		return nil
+	}})
+
+	store := session.NewMemoryStore([]byte("secret"))
+	provider := &testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: "secret"}}}
+	app := newTestApp(store, provider)
+
+	login := func(password string) error {
+		var err error
+
+		app.POST("/login", func(c echo.Context) error {
+			err = Default(c).Attempt(Credentials{"email": "a@b.c", PasswordKey: password})
+			return nil
+		})
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil))
+
+		return err
+	}
+
+	for i := 1; i < MaxAttempts; i++ {
+		if err := login("wrong"); err != ErrInvalidCredentials {
+			t.Fatalf("attempt %d: expect ErrInvalidCredentials, got %v", i, err)
+		}
+	}
+
+	if err := login("wrong"); err != ErrTooManyAttempts {
+		t.Fatalf("expect ErrTooManyAttempts, got %v", err)
+	}
+
+	if err := login("secret"); err != ErrTooManyAttempts {
+		t.Errorf("expect the right password to be locked out too, got %v", err)
+	}
+
+	if lockouts != 2 {
+		t.Errorf("expect 2 lockout events, got %d", lockouts)
+	}
+
+	adapter.ClearAll()
+
+	if err := login("secret"); err != nil {
+		t.Errorf("expect login after the lockout, got %v", err)
+	}
+}
+
+func TestSessionGuard_Login(t *testing.T) {
+	store := session.NewMemoryStore([]byte("secret"))
+	provider := &testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: "secret"}}}
+	app := newTestApp(store, provider)
+
+	app.POST("/login", func(c echo.Context) error {
+		return Default(c).Login(provider.users[0])
+	})
+
+	// a session planted before the login
+	store.Put("planted", map[interface{}]interface{}{"visited": true})
+	cookie, _ := store.Cookie("session", "planted")
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.AddCookie(cookie)
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	ids := store.Sessions()
+
+	if len(ids) != 1 || ids[0] == "planted" {
+		t.Fatalf("expect the session ID to change on login, got %v", ids)
+	}
+
+	if values, _ := store.Values(ids[0]); values["auth_web"] != 1 || values["visited"] != true {
+		t.Errorf("expect the values to be kept, got %v", values)
+	}
+
+	// without the session middleware
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/login", nil), httptest.NewRecorder())
+	guard := NewSessionGuard("web", provider, c)
+
+	if err := guard.Login(provider.users[0]); err != ErrNoSession {
+		t.Errorf("expect ErrNoSession from Login, got %v", err)
+	}
+
+	if err := guard.Logout(); err != ErrNoSession {
+		t.Errorf("expect ErrNoSession from Logout, got %v", err)
+	}
+}
+
+func TestAuthManager_UnknownGuard(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	manager := Default(c)
+
+	if manager.Guard("missing") != nil {
+		t.Error("expect no guard for an unknown name")
+	}
+
+	manager.ShouldUse("missing")
+
+	if manager.Check() || manager.User() != nil || manager.Attempt(Credentials{}) != ErrUnknownGuard {
+		t.Error("expect a guest and ErrUnknownGuard with an unknown guard")
+	}
+}
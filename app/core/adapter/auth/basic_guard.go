@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"github.com/labstack/echo"
+)
+
+// BasicGuard authenticates every request with HTTP basic auth credentials.
+type BasicGuard struct {
+	// UsernameKey is the credentials key the basic auth username is sent as.
+	UsernameKey string
+	// Realm is sent in the WWW-Authenticate header of rejected requests.
+	Realm string
+
+	name     string
+	provider IUserProvider
+	context  echo.Context
+	user     IUser
+	resolved bool
+}
+
+func NewBasicGuard(name string, provider IUserProvider, context echo.Context) *BasicGuard {
+	return &BasicGuard{
+		UsernameKey: "email",
+		Realm:       "Restricted",
+		name:        name,
+		provider:    provider,
+		context:     context,
+	}
+}
+
+func (self *BasicGuard) Name() string {
+	return self.name
+}
+
+func (self *BasicGuard) Check() bool {
+	return self.User() != nil
+}
+
+func (self *BasicGuard) Guest() bool {
+	return !self.Check()
+}
+
+func (self *BasicGuard) User() IUser {
+	if self.resolved {
+		return self.user
+	}
+
+	self.resolved = true
+
+	if username, password, ok := self.context.Request().BasicAuth(); ok {
+		if user, err := attempt(self.provider, Credentials{self.UsernameKey: username, PasswordKey: password}); err == nil {
+			self.user = user
+		}
+	}
+
+	return self.user
+}
+
+func (self *BasicGuard) ID() interface{} {
+	if user := self.User(); user != nil {
+		return user.GetId()
+	}
+
+	return nil
+}
+
+func (self *BasicGuard) Validate(credentials Credentials) bool {
+	_, err := attempt(self.provider, credentials)
+
+	return err == nil
+}
+
+func (self *BasicGuard) Attempt(credentials Credentials) error {
+	user, err := attempt(self.provider, credentials)
+
+	if err != nil {
+		return err
+	}
+
+	return self.Login(user)
+}
+
+// Login sets the user for the current request only.
+func (self *BasicGuard) Login(user IUser) error {
+	self.user = user
+	self.resolved = true
+
+	return nil
+}
+
+func (self *BasicGuard) Logout() error {
+	self.user = nil
+	self.resolved = true
+
+	return nil
+}
+
+// Challenge asks the client for credentials.
+func (self *BasicGuard) Challenge() {
+	self.context.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="`+self.Realm+`"`)
+}
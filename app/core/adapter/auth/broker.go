@@ -0,0 +1,448 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/database"
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/dulumao/Guten-utils/conv"
+)
+
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+// EventPasswordReset is emitted with a *PasswordResetEvent after a password
+// was reset, e.g. to end the other sessions of the user.
+const EventPasswordReset = "auth.password.reset"
+
+// PasswordResetEvent is the payload of EventPasswordReset.
+type PasswordResetEvent struct {
+	User IUser
+}
+
+var (
+	ErrInvalidUserToken = errors.New("auth: invalid or expired token")
+	ErrTokenThrottled   = errors.New("auth: token requested too often")
+)
+
+// UserToken is a single-use token mailed to a user, e.g. to reset the
+// password. Only the SHA-256 of the token is stored.
+type UserToken struct {
+	Id        uint   `gorm:"primary_key"`
+	Purpose   string `gorm:"size:32;index"`
+	UserId    string `gorm:"size:64;index"`
+	Token     string `gorm:"size:64;unique_index"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+func (self *UserToken) TableName() string {
+	return "user_tokens"
+}
+
+// IUserTokenRepository stores user tokens.
+type IUserTokenRepository interface {
+	Create(token *UserToken) error
+	// Find returns the token with the hash, ErrInvalidUserToken if there is none.
+	Find(purpose string, hash string) (*UserToken, error)
+	// Latest returns the newest token of the user, nil if there is none.
+	Latest(purpose string, userId string) (*UserToken, error)
+	// Delete removes the token with the hash and reports whether it existed,
+	// of concurrent calls for one token only one gets true.
+	Delete(purpose string, hash string) (bool, error)
+	DeleteByUser(purpose string, userId string) error
+}
+
+var (
+	userTokenMutex      sync.RWMutex
+	userTokenRepository IUserTokenRepository = new(GormUserTokenRepository)
+)
+
+// SetUserTokenRepository sets where user tokens are stored.
+func SetUserTokenRepository(repository IUserTokenRepository) {
+	userTokenMutex.Lock()
+	userTokenRepository = repository
+	userTokenMutex.Unlock()
+}
+
+func GetUserTokenRepository() IUserTokenRepository {
+	userTokenMutex.RLock()
+	defer userTokenMutex.RUnlock()
+
+	return userTokenRepository
+}
+
+// INotifier delivers the link of a token to the user, usually by mail.
+type INotifier interface {
+	Notify(purpose string, user IUser, link string) error
+}
+
+// NotifierFunc adapts a function to INotifier.
+type NotifierFunc func(purpose string, user IUser, link string) error
+
+func (self NotifierFunc) Notify(purpose string, user IUser, link string) error {
+	return self(purpose, user, link)
+}
+
+// IPasswordChanger is implemented by providers that can store a new password.
+type IPasswordChanger interface {
+	ChangePassword(user IUser, password string) error
+}
+
+// IEmailVerifier is implemented by providers that can mark an email address verified.
+type IEmailVerifier interface {
+	MarkEmailVerified(user IUser) error
+}
+
+// Broker issues and checks the tokens of one purpose. A token is
+// "<payload>.<signature>", the payload holding the purpose, user and expiry,
+// signed with HMAC-SHA256 so forged tokens are rejected before the lookup.
+type Broker struct {
+	Purpose  string
+	Provider IUserProvider
+	Notifier INotifier
+	// Key signs the tokens.
+	Key []byte
+	// TTL is how long a token is valid.
+	TTL time.Duration
+	// Throttle is the minimum time between two tokens of a user.
+	Throttle time.Duration
+}
+
+// NewPasswordBroker returns a broker for password reset tokens valid for an hour.
+func NewPasswordBroker(provider IUserProvider, notifier INotifier, key []byte) *Broker {
+	return &Broker{
+		Purpose:  PurposePasswordReset,
+		Provider: provider,
+		Notifier: notifier,
+		Key:      key,
+		TTL:      time.Hour,
+		Throttle: time.Minute,
+	}
+}
+
+// NewVerificationBroker returns a broker for email verification tokens valid for a day.
+func NewVerificationBroker(provider IUserProvider, notifier INotifier, key []byte) *Broker {
+	return &Broker{
+		Purpose:  PurposeVerifyEmail,
+		Provider: provider,
+		Notifier: notifier,
+		Key:      key,
+		TTL:      24 * time.Hour,
+		Throttle: time.Minute,
+	}
+}
+
+// Send looks the user up by the credentials and sends the link to a new token.
+// link turns the token into the URL the user has to open.
+func (self *Broker) Send(credentials Credentials, link func(token string) string) error {
+	user, err := self.Provider.RetrieveByCredentials(credentials)
+
+	if err != nil || user == nil {
+		return ErrInvalidCredentials
+	}
+
+	return self.SendTo(user, link)
+}
+
+// SendTo sends the link to a new token to the user, replacing older tokens.
+func (self *Broker) SendTo(user IUser, link func(token string) string) error {
+	var userId = conv.String(user.GetId())
+	var repository = GetUserTokenRepository()
+
+	if self.Throttle > 0 {
+		latest, err := repository.Latest(self.Purpose, userId)
+
+		if err == nil && latest != nil && time.Since(latest.CreatedAt) < self.Throttle {
+			return ErrTokenThrottled
+		}
+	}
+
+	token, err := self.Create(user)
+
+	if err != nil {
+		return err
+	}
+
+	return self.Notifier.Notify(self.Purpose, user, link(token))
+}
+
+// Create stores and returns a new token of the user, replacing older tokens.
+func (self *Broker) Create(user IUser) (string, error) {
+	var userId = conv.String(user.GetId())
+	var repository = GetUserTokenRepository()
+	var expiresAt = time.Now().Add(self.TTL)
+
+	nonce, err := randomString(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	payload := strings.Join([]string{self.Purpose, userId, strconv.FormatInt(expiresAt.Unix(), 10), nonce}, "|")
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + self.sign(payload)
+
+	if err := repository.DeleteByUser(self.Purpose, userId); err != nil {
+		return "", err
+	}
+
+	err = repository.Create(&UserToken{
+		Purpose:   self.Purpose,
+		UserId:    userId,
+		Token:     hashToken(token),
+		ExpiresAt: expiresAt,
+	})
+
+	return token, err
+}
+
+// Validate returns the user of a valid token without using it up.
+func (self *Broker) Validate(token string) (IUser, error) {
+	userId, err := self.verify(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := GetUserTokenRepository().Find(self.Purpose, hashToken(token))
+
+	if err != nil || stored == nil || stored.UserId != userId || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	user, err := self.Provider.RetrieveById(userId)
+
+	if err != nil || user == nil {
+		return nil, ErrInvalidUserToken
+	}
+
+	return user, nil
+}
+
+// Consume validates the token and deletes it, so it can not be used again.
+// Of concurrent requests with the same token only the one that deleted it
+// gets the user.
+func (self *Broker) Consume(token string) (IUser, error) {
+	user, err := self.Validate(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := GetUserTokenRepository().Delete(self.Purpose, hashToken(token))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !deleted {
+		return nil, ErrInvalidUserToken
+	}
+
+	return user, nil
+}
+
+// Reset uses up a password reset token, changes the password and revokes
+// the remember tokens of the user, then emits EventPasswordReset. The
+// provider has to implement IPasswordChanger.
+func (self *Broker) Reset(token string, password string) (IUser, error) {
+	changer, ok := self.Provider.(IPasswordChanger)
+
+	if !ok {
+		return nil, errors.New("auth: provider can not change passwords")
+	}
+
+	user, err := self.Consume(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := changer.ChangePassword(user, password); err != nil {
+		return user, err
+	}
+
+	// remembered devices, an attacker's among them, have to log in again
+	if err := RevokeRememberTokens(user); err != nil {
+		return user, err
+	}
+
+	return user, observer.Emit(EventPasswordReset, &PasswordResetEvent{User: user})
+}
+
+// Verify uses up an email verification token and marks the email verified.
+// The provider has to implement IEmailVerifier.
+func (self *Broker) Verify(token string) (IUser, error) {
+	verifier, ok := self.Provider.(IEmailVerifier)
+
+	if !ok {
+		return nil, errors.New("auth: provider can not verify emails")
+	}
+
+	user, err := self.Consume(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, verifier.MarkEmailVerified(user)
+}
+
+func (self *Broker) sign(payload string) string {
+	mac := hmac.New(sha256.New, self.Key)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature, purpose and expiry and returns the user ID.
+func (self *Broker) verify(token string) (string, error) {
+	var parts = strings.SplitN(token, ".", 2)
+
+	if len(parts) != 2 {
+		return "", ErrInvalidUserToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil || !hmac.Equal([]byte(self.sign(string(payload))), []byte(parts[1])) {
+		return "", ErrInvalidUserToken
+	}
+
+	var fields = strings.Split(string(payload), "|")
+
+	if len(fields) != 4 || fields[0] != self.Purpose {
+		return "", ErrInvalidUserToken
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", ErrInvalidUserToken
+	}
+
+	return fields[1], nil
+}
+
+// GormUserTokenRepository stores user tokens in the user_tokens table.
+type GormUserTokenRepository struct{}
+
+func (self *GormUserTokenRepository) Create(token *UserToken) error {
+	return database.DB.Create(token).Error
+}
+
+func (self *GormUserTokenRepository) Find(purpose string, hash string) (*UserToken, error) {
+	var token = new(UserToken)
+
+	if err := database.DB.Where("purpose = ? AND token = ?", purpose, hash).First(token).Error; err != nil {
+		return nil, ErrInvalidUserToken
+	}
+
+	return token, nil
+}
+
+func (self *GormUserTokenRepository) Latest(purpose string, userId string) (*UserToken, error) {
+	var tokens []*UserToken
+
+	if err := database.DB.Where("purpose = ? AND user_id = ?", purpose, userId).Order("created_at DESC").Limit(1).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	return tokens[0], nil
+}
+
+func (self *GormUserTokenRepository) Delete(purpose string, hash string) (bool, error) {
+	result := database.DB.Where("purpose = ? AND token = ?", purpose, hash).Delete(UserToken{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (self *GormUserTokenRepository) DeleteByUser(purpose string, userId string) error {
+	return database.DB.Where("purpose = ? AND user_id = ?", purpose, userId).Delete(UserToken{}).Error
+}
+
+// MemoryUserTokenRepository keeps user tokens in memory, for tests.
+type MemoryUserTokenRepository struct {
+	mutex  sync.RWMutex
+	tokens map[string]UserToken
+}
+
+func NewMemoryUserTokenRepository() *MemoryUserTokenRepository {
+	return &MemoryUserTokenRepository{tokens: make(map[string]UserToken)}
+}
+
+func (self *MemoryUserTokenRepository) Create(token *UserToken) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	token.CreatedAt = time.Now()
+	self.tokens[token.Token] = *token
+
+	return nil
+}
+
+func (self *MemoryUserTokenRepository) Find(purpose string, hash string) (*UserToken, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if token, ok := self.tokens[hash]; ok && token.Purpose == purpose {
+		return &token, nil
+	}
+
+	return nil, ErrInvalidUserToken
+}
+
+func (self *MemoryUserTokenRepository) Latest(purpose string, userId string) (*UserToken, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var latest *UserToken
+
+	for _, token := range self.tokens {
+		if token.Purpose == purpose && token.UserId == userId && (latest == nil || token.CreatedAt.After(latest.CreatedAt)) {
+			t := token
+			latest = &t
+		}
+	}
+
+	return latest, nil
+}
+
+func (self *MemoryUserTokenRepository) Delete(purpose string, hash string) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if token, ok := self.tokens[hash]; !ok || token.Purpose != purpose {
+		return false, nil
+	}
+
+	delete(self.tokens, hash)
+
+	return true, nil
+}
+
+func (self *MemoryUserTokenRepository) DeleteByUser(purpose string, userId string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for hash, token := range self.tokens {
+		if token.Purpose == purpose && token.UserId == userId {
+			delete(self.tokens, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"github.com/dulumao/Guten-framework/app/core/env"
+	"github.com/labstack/echo"
+)
+
+// StatusFlashKey is the flash key of the messages set by the broker handlers.
+const StatusFlashKey = "status"
+
+var ErrNoBaseURL = errors.New("auth: the base URL of the links is not configured, set server.url")
+
+// PasswordHandlers are ready-made handlers for the password reset pages.
+// The views get "status", "error", "email" and "token".
+//
+//	handlers := auth.NewPasswordHandlers(broker)
+//	app.GET("/password/forgot", handlers.ShowRequestForm)
+//	app.POST("/password/forgot", handlers.SendResetLink)
+//	app.GET("/password/reset/:token", handlers.ShowResetForm)
+//	app.POST("/password/reset/:token", handlers.Reset)
+type PasswordHandlers struct {
+	Broker *Broker
+	// EmailKey is the form field and credential of the email. Default "email".
+	EmailKey    string
+	RequestView string
+	ResetView   string
+	// BaseURL starts the links in the mails, e.g. "https://example.com".
+	// Default server.url of env.toml. The Host header of the request is
+	// not used, it is chosen by the client.
+	BaseURL string
+	// ResetPath is the path of the reset form, the token is appended.
+	ResetPath string
+	// RedirectTo is where users go after the password was reset.
+	RedirectTo string
+}
+
+func NewPasswordHandlers(broker *Broker) *PasswordHandlers {
+	return &PasswordHandlers{
+		Broker:      broker,
+		EmailKey:    "email",
+		BaseURL:     baseURL(),
+		RequestView: "auth/passwords/email",
+		ResetView:   "auth/passwords/reset",
+		ResetPath:   "/password/reset/",
+		RedirectTo:  "/login",
+	}
+}
+
+func (self *PasswordHandlers) ShowRequestForm(context echo.Context) error {
+	return context.Render(http.StatusOK, self.RequestView, map[string]interface{}{
+		"status": flash(context),
+	})
+}
+
+// SendResetLink answers the same whether the email is known or not and
+// whether its link was throttled, so the form can not be used to find out
+// which addresses have an account.
+func (self *PasswordHandlers) SendResetLink(context echo.Context) error {
+	var email = strings.TrimSpace(context.FormValue(self.EmailKey))
+
+	if self.BaseURL == "" {
+		return ErrNoBaseURL
+	}
+
+	err := self.Broker.Send(Credentials{self.EmailKey: email}, func(token string) string {
+		return absoluteURL(self.BaseURL, self.ResetPath+token)
+	})
+
+	if err != nil && err != ErrInvalidCredentials && err != ErrTokenThrottled {
+		return err
+	}
+
+	return context.Render(http.StatusOK, self.RequestView, map[string]interface{}{
+		"email":  email,
+		"status": "We have emailed your password reset link.",
+	})
+}
+
+func (self *PasswordHandlers) ShowResetForm(context echo.Context) error {
+	var token = context.Param("token")
+
+	if _, err := self.Broker.Validate(token); err != nil {
+		return context.Render(http.StatusBadRequest, self.ResetView, map[string]interface{}{
+			"error": "This password reset token is invalid.",
+		})
+	}
+
+	return context.Render(http.StatusOK, self.ResetView, map[string]interface{}{
+		"token": token,
+	})
+}
+
+func (self *PasswordHandlers) Reset(context echo.Context) error {
+	var token = context.Param("token")
+	var password = context.FormValue(PasswordKey)
+
+	if password == "" || password != context.FormValue(PasswordKey+"_confirmation") {
+		return context.Render(http.StatusUnprocessableEntity, self.ResetView, map[string]interface{}{
+			"token": token,
+			"error": "The password confirmation does not match.",
+		})
+	}
+
+	if _, err := self.Broker.Reset(token, password); err != nil {
+		if err != ErrInvalidUserToken {
+			return err
+		}
+
+		return context.Render(http.StatusBadRequest, self.ResetView, map[string]interface{}{
+			"error": "This password reset token is invalid.",
+		})
+	}
+
+	setFlash(context, "Your password has been reset.")
+
+	return context.Redirect(http.StatusFound, self.RedirectTo)
+}
+
+// VerificationHandlers are ready-made handlers for the email verification pages.
+//
+//	handlers := auth.NewVerificationHandlers(broker)
+//	app.GET("/email/verify", handlers.Notice)
+//	app.POST("/email/verify", handlers.Resend)
+//	app.GET("/email/verify/:token", handlers.Verify)
+type VerificationHandlers struct {
+	Broker *Broker
+	// Guard is the guard of the logged in user. Default the default guard.
+	Guard string
+	// BaseURL starts the links in the mails. Default server.url of env.toml.
+	BaseURL    string
+	NoticeView string
+	// VerifyPath is the path of the verification link, the token is appended.
+	VerifyPath string
+	// RedirectTo is where users go after the email was verified.
+	RedirectTo string
+}
+
+func NewVerificationHandlers(broker *Broker) *VerificationHandlers {
+	return &VerificationHandlers{
+		Broker:     broker,
+		BaseURL:    baseURL(),
+		NoticeView: "auth/verify",
+		VerifyPath: "/email/verify/",
+		RedirectTo: "/",
+	}
+}
+
+func (self *VerificationHandlers) Notice(context echo.Context) error {
+	return context.Render(http.StatusOK, self.NoticeView, map[string]interface{}{
+		"status": flash(context),
+	})
+}
+
+// Resend mails a new verification link to the logged in user.
+func (self *VerificationHandlers) Resend(context echo.Context) error {
+	guard := Default(context).Guard(self.Guard)
+
+	if guard == nil || guard.User() == nil {
+		return echo.ErrUnauthorized
+	}
+
+	if self.BaseURL == "" {
+		return ErrNoBaseURL
+	}
+
+	user := guard.User()
+
+	err := self.Broker.SendTo(user, func(token string) string {
+		return absoluteURL(self.BaseURL, self.VerifyPath+token)
+	})
+
+	if err == ErrTokenThrottled {
+		return context.Render(http.StatusTooManyRequests, self.NoticeView, map[string]interface{}{
+			"error": "Please wait before retrying.",
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return context.Render(http.StatusOK, self.NoticeView, map[string]interface{}{
+		"status": "A fresh verification link has been sent to your email address.",
+	})
+}
+
+func (self *VerificationHandlers) Verify(context echo.Context) error {
+	if _, err := self.Broker.Verify(context.Param("token")); err != nil {
+		if err != ErrInvalidUserToken {
+			return err
+		}
+
+		return context.Render(http.StatusBadRequest, self.NoticeView, map[string]interface{}{
+			"error": "This verification link is invalid or has expired.",
+		})
+	}
+
+	setFlash(context, "Your email address has been verified.")
+
+	return context.Redirect(http.StatusFound, self.RedirectTo)
+}
+
+func baseURL() string {
+	if env.Value != nil {
+		return env.Value.Server.URL
+	}
+
+	return ""
+}
+
+func absoluteURL(base string, path string) string {
+	return strings.TrimRight(base, "/") + path
+}
+
+func flash(context echo.Context) interface{} {
+	sess := session.Default(context)
+
+	if sess == nil {
+		return nil
+	}
+
+	flashes := sess.Flashes(StatusFlashKey)
+	sess.Save()
+
+	if len(flashes) == 0 {
+		return nil
+	}
+
+	return flashes[0]
+}
+
+func setFlash(context echo.Context, message string) {
+	if sess := session.Default(context); sess != nil {
+		sess.AddFlash(message, StatusFlashKey)
+		sess.Save()
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/dulumao/Guten-utils/os/event"
+	"github.com/labstack/echo"
+)
+
+type testChangerProvider struct {
+	testProvider
+	changed map[int]string
+}
+
+func (self *testChangerProvider) RetrieveById(id interface{}) (IUser, error) {
+	return self.testProvider.RetrieveById(conv.Int(id))
+}
+
+func (self *testChangerProvider) ChangePassword(user IUser, password string) error {
+	self.changed[user.GetId().(int)] = password
+
+	return nil
+}
+
+func TestBroker(t *testing.T) {
+	SetUserTokenRepository(NewMemoryUserTokenRepository())
+	defer SetUserTokenRepository(new(GormUserTokenRepository))
+
+	remember := NewMemoryRememberRepository()
+	SetRememberRepository(remember)
+	defer SetRememberRepository(new(GormRememberRepository))
+
+	var reset IUser
+
+	observer.On(EventPasswordReset, event.Listener{Callback: func(e *event.Event) error {
+		reset = e.Data.(*PasswordResetEvent).User
+		return nil
+	}})
+	defer observer.New()
+
+	provider := &testChangerProvider{
+		testProvider: testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: "secret"}}},
+		changed:      make(map[int]string),
+	}
+
+	var link string
+	broker := NewPasswordBroker(provider, NotifierFunc(func(purpose string, user IUser, l string) error {
+		link = l
+		return nil
+	}), []byte("key"))
+
+	if err := broker.Send(Credentials{"email": "x@y.z"}, nil); err != ErrInvalidCredentials {
+		t.Errorf("expect unknown users to fail, got %v", err)
+	}
+
+	err := broker.Send(Credentials{"email": "a@b.c"}, func(token string) string {
+		return "/password/reset/" + token
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := broker.Send(Credentials{"email": "a@b.c"}, func(string) string { return "" }); err != ErrTokenThrottled {
+		t.Errorf("expect a second request to be throttled, got %v", err)
+	}
+
+	token := strings.TrimPrefix(link, "/password/reset/")
+
+	if _, err := NewVerificationBroker(provider, nil, []byte("key")).Validate(token); err != ErrInvalidUserToken {
+		t.Error("expect tokens to be bound to their purpose")
+	}
+
+	if _, err := NewPasswordBroker(provider, nil, []byte("other")).Validate(token); err != ErrInvalidUserToken {
+		t.Error("expect tokens signed with another key to fail")
+	}
+
+	remembered, _, _ := newRememberToken("web", 1, time.Hour)
+	remember.Create(remembered)
+
+	if _, err := broker.Reset(token, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if provider.changed[1] != "new" {
+		t.Error("expect the password to be changed")
+	}
+
+	if len(remember.Tokens("1")) != 0 || reset == nil || reset.GetId() != 1 {
+		t.Error("expect the reset to revoke the remember tokens and be emitted")
+	}
+
+	if _, err := broker.Reset(token, "again"); err != ErrInvalidUserToken {
+		t.Error("expect a token to work only once")
+	}
+}
+
+type testRenderer struct{}
+
+func (testRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	return nil
+}
+
+func TestPasswordHandlers_SendResetLink(t *testing.T) {
+	SetUserTokenRepository(NewMemoryUserTokenRepository())
+	defer SetUserTokenRepository(new(GormUserTokenRepository))
+
+	provider := &testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: "secret"}}}
+
+	var links []string
+	handlers := NewPasswordHandlers(NewPasswordBroker(provider, NotifierFunc(func(purpose string, user IUser, link string) error {
+		links = append(links, link)
+		return nil
+	}), []byte("key")))
+	handlers.BaseURL = "https://example.com/"
+
+	app := echo.New()
+	app.Renderer = testRenderer{}
+	app.POST("/password/forgot", handlers.SendResetLink)
+
+	// known, throttled and unknown addresses get the same answer
+	for _, email := range []string{"a@b.c", "a@b.c", "x@y.z"} {
+		req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader("email="+email))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Host = "attacker.example"
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expect 200, got %d", email, rec.Code)
+		}
+	}
+
+	if len(links) != 1 || !strings.HasPrefix(links[0], "https://example.com/password/reset/") {
+		t.Errorf("expect one link to the base URL, got %v", links)
+	}
+}
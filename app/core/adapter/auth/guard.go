@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+// IGuard authenticates the user of a single request.
+type IGuard interface {
+	// Name returns the name the guard was registered with.
+	Name() string
+	// Check reports whether the request is authenticated.
+	Check() bool
+	// Guest reports whether the request is not authenticated.
+	Guest() bool
+	// User returns the authenticated user, or nil.
+	User() IUser
+	// ID returns the identifier of the authenticated user, or nil.
+	ID() interface{}
+	// Validate checks the credentials without logging the user in.
+	Validate(credentials Credentials) bool
+	// Attempt checks the credentials and logs the user in on success.
+	Attempt(credentials Credentials) error
+	// Login authenticates the user.
+	Login(user IUser) error
+	// Logout forgets the authenticated user.
+	Logout() error
+}
+
+// GuardDriver creates the guard registered as name for a request.
+type GuardDriver func(name string, context echo.Context) IGuard
+
+var (
+	guardsMutex  sync.RWMutex
+	guards       = make(map[string]GuardDriver)
+	defaultGuard = "web"
+)
+
+// RegisterGuard makes a guard available by name, e.g.
+//
+//	auth.RegisterGuard("web", func(name string, c echo.Context) auth.IGuard {
+//		return auth.NewSessionGuard(name, provider, c)
+//	})
+func RegisterGuard(name string, driver GuardDriver) {
+	if driver == nil {
+		panic("auth: RegisterGuard driver is nil")
+	}
+
+	guardsMutex.Lock()
+	guards[name] = driver
+	guardsMutex.Unlock()
+}
+
+// SetDefaultGuard sets the guard used when no guard name is given.
+func SetDefaultGuard(name string) {
+	guardsMutex.Lock()
+	defaultGuard = name
+	guardsMutex.Unlock()
+}
+
+func getDefaultGuard() string {
+	guardsMutex.RLock()
+	defer guardsMutex.RUnlock()
+
+	return defaultGuard
+}
+
+func getGuardDriver(name string) (GuardDriver, bool) {
+	guardsMutex.RLock()
+	defer guardsMutex.RUnlock()
+
+	driver, ok := guards[name]
+
+	return driver, ok
+}
+
+// attempt is shared by the guards: look the user up, check the password and
+// upgrade its hash if the hasher settings changed since it was stored.
+// Unknown users are checked against a dummy hash, so the time of the
+// response does not tell which accounts exist.
+func attempt(provider IUserProvider, credentials Credentials) (IUser, error) {
+	user, err := provider.RetrieveByCredentials(credentials)
+
+	if err != nil || user == nil {
+		checkDummy(credentials[PasswordKey])
+
+		return nil, ErrInvalidCredentials
+	}
+
+	if !provider.ValidateCredentials(user, credentials) {
+		return nil, ErrInvalidCredentials
+	}
+
+	if rehasher, ok := provider.(IPasswordRehasher); ok {
+		// a failed rehash must not fail the login, the old hash is still valid
+		_ = rehasher.RehashPasswordIfRequired(user, credentials[PasswordKey])
+	}
+
+	return user, nil
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidHash = errors.New("auth: invalid password hash")
+
+// IHasher hashes and verifies passwords.
+type IHasher interface {
+	// Make returns the hash of the password.
+	Make(password string) (string, error)
+	// Check reports whether the password matches the hash.
+	Check(password, hashed string) bool
+	// NeedsRehash reports whether the hash was made by another algorithm or
+	// with other cost parameters than the hasher currently uses.
+	NeedsRehash(hashed string) bool
+}
+
+var (
+	hasherMutex sync.RWMutex
+	hasher      IHasher = NewBcryptHasher(bcrypt.DefaultCost)
+
+	// dummyHash is a hash of the current hasher, checked for unknown users
+	dummyMutex sync.Mutex
+	dummyHash  string
+)
+
+// SetHasher sets the hasher used by the user providers.
+func SetHasher(h IHasher) {
+	hasherMutex.Lock()
+	hasher = h
+	hasherMutex.Unlock()
+
+	dummyMutex.Lock()
+	dummyHash = ""
+	dummyMutex.Unlock()
+}
+
+// checkDummy checks the password against a hash of the current hasher, so a
+// login of an unknown user takes as long as one of a known user.
+func checkDummy(password string) {
+	var h = GetHasher()
+
+	dummyMutex.Lock()
+
+	if dummyHash == "" {
+		dummyHash, _ = h.Make("dummy password")
+	}
+
+	var hashed = dummyHash
+
+	dummyMutex.Unlock()
+
+	if hashed != "" {
+		h.Check(password, hashed)
+	}
+}
+
+// GetHasher returns the hasher used by the user providers.
+func GetHasher() IHasher {
+	hasherMutex.RLock()
+	defer hasherMutex.RUnlock()
+
+	return hasher
+}
+
+// HashPassword hashes the password with the current hasher.
+func HashPassword(password string) (string, error) {
+	return GetHasher().Make(password)
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &BcryptHasher{Cost: cost}
+}
+
+func (self *BcryptHasher) Make(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), self.Cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashed), nil
+}
+
+func (self *BcryptHasher) Check(password, hashed string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+}
+
+func (self *BcryptHasher) NeedsRehash(hashed string) bool {
+	cost, err := bcrypt.Cost([]byte(hashed))
+
+	return err != nil || cost != self.Cost
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func NewArgon2idHasher(memory, iterations uint32, parallelism uint8) *Argon2idHasher {
+	if memory == 0 {
+		memory = 64 * 1024
+	}
+
+	if iterations == 0 {
+		iterations = 3
+	}
+
+	if parallelism == 0 {
+		parallelism = 2
+	}
+
+	return &Argon2idHasher{
+		Memory:      memory,
+		Iterations:  iterations,
+		Parallelism: parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (self *Argon2idHasher) Make(password string) (string, error) {
+	salt := make([]byte, self.SaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, self.Iterations, self.Memory, self.Parallelism, self.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		self.Memory,
+		self.Iterations,
+		self.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (self *Argon2idHasher) Check(password, hashed string) bool {
+	params, salt, key, err := decodeArgon2id(hashed)
+
+	if err != nil {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (self *Argon2idHasher) NeedsRehash(hashed string) bool {
+	params, salt, key, err := decodeArgon2id(hashed)
+
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != self.Memory ||
+		params.Iterations != self.Iterations ||
+		params.Parallelism != self.Parallelism ||
+		uint32(len(salt)) != self.SaltLength ||
+		uint32(len(key)) != self.KeyLength
+}
+
+func decodeArgon2id(hashed string) (*Argon2idHasher, []byte, []byte, error) {
+	var parts = strings.Split(hashed, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	var params = new(Argon2idHasher)
+
+	// argon2 panics without iterations or parallelism
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, key, nil
+}
+
+// CheckPassword verifies the password against a hash made by any of the
+// supported hashers, so switching hashers does not lock existing users out.
+func CheckPassword(password, hashed string) bool {
+	if strings.HasPrefix(hashed, "$argon2id$") {
+		return new(Argon2idHasher).Check(password, hashed)
+	}
+
+	if strings.HasPrefix(hashed, "$2") {
+		return new(BcryptHasher).Check(password, hashed)
+	}
+
+	return GetHasher().Check(password, hashed)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := NewBcryptHasher(bcrypt.MinCost)
+	hashed, err := hasher.Make("secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasher.Check("secret", hashed) || hasher.Check("wrong", hashed) {
+		t.Error("expect only the right password to match")
+	}
+
+	if hasher.NeedsRehash(hashed) {
+		t.Error("expect no rehash with the same cost")
+	}
+
+	if !NewBcryptHasher(bcrypt.MinCost + 1).NeedsRehash(hashed) {
+		t.Error("expect rehash when the cost changes")
+	}
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := NewArgon2idHasher(1024, 1, 1)
+	hashed, err := hasher.Make("secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasher.Check("secret", hashed) || hasher.Check("wrong", hashed) {
+		t.Error("expect only the right password to match")
+	}
+
+	if hasher.NeedsRehash(hashed) {
+		t.Error("expect no rehash with the same parameters")
+	}
+
+	if !NewArgon2idHasher(2048, 1, 1).NeedsRehash(hashed) {
+		t.Error("expect rehash when the memory changes")
+	}
+
+	if !hasher.NeedsRehash("$2a$10$invalid") {
+		t.Error("expect rehash of a bcrypt hash")
+	}
+
+	// argon2 panics on these parameters
+	for _, params := range []string{"m=1024,t=0,p=1", "m=1024,t=1,p=0"} {
+		if _, _, _, err := decodeArgon2id(strings.Replace(hashed, "m=1024,t=1,p=1", params, 1)); err != ErrInvalidHash {
+			t.Errorf("decodeArgon2id with %s: %v", params, err)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	bcryptHash, _ := NewBcryptHasher(bcrypt.MinCost).Make("secret")
+	argonHash, _ := NewArgon2idHasher(1024, 1, 1).Make("secret")
+
+	for _, hashed := range []string{bcryptHash, argonHash} {
+		if !CheckPassword("secret", hashed) {
+			t.Errorf("expect %s to match", hashed)
+		}
+
+		if CheckPassword("wrong", hashed) {
+			t.Errorf("expect %s not to match", hashed)
+		}
+	}
+}
+
+type rehashProvider struct {
+	testProvider
+	updated string
+}
+
+func (self *rehashProvider) ValidateCredentials(user IUser, credentials Credentials) bool {
+	return CheckPassword(credentials[PasswordKey], user.GetPassword())
+}
+
+func (self *rehashProvider) RehashPasswordIfRequired(user IUser, password string) error {
+	if GetHasher().NeedsRehash(user.GetPassword()) {
+		self.updated, _ = HashPassword(password)
+	}
+
+	return nil
+}
+
+type countingHasher struct {
+	*BcryptHasher
+	checks int
+}
+
+func (self *countingHasher) Check(password, hashed string) bool {
+	self.checks++
+
+	return self.BcryptHasher.Check(password, hashed)
+}
+
+func TestAttempt_UnknownUser(t *testing.T) {
+	defer SetHasher(GetHasher())
+
+	hasher := &countingHasher{BcryptHasher: NewBcryptHasher(bcrypt.MinCost)}
+	SetHasher(hasher)
+
+	if _, err := attempt(&testProvider{}, Credentials{"email": "nobody@b.c", PasswordKey: "secret"}); err != ErrInvalidCredentials {
+		t.Fatal(err)
+	}
+
+	if hasher.checks != 1 {
+		t.Errorf("expect a dummy hash to be checked for an unknown user, got %d checks", hasher.checks)
+	}
+}
+
+func TestAttempt_Rehash(t *testing.T) {
+	defer SetHasher(GetHasher())
+
+	old, _ := NewBcryptHasher(bcrypt.MinCost).Make("secret")
+	provider := &rehashProvider{testProvider: testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: old}}}}
+
+	SetHasher(NewArgon2idHasher(1024, 1, 1))
+
+	if _, err := attempt(provider, Credentials{"email": "a@b.c", PasswordKey: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if provider.updated == "" || !GetHasher().Check("secret", provider.updated) {
+		t.Errorf("expect password to be rehashed with argon2id, got %q", provider.updated)
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/dulumao/Guten-utils/conv"
+)
+
+var (
+	ErrInvalidToken = errors.New("auth: invalid token")
+	ErrUnknownKey   = errors.New("auth: unknown token signing key")
+)
+
+// JWTKey is a key that signs or verifies tokens. Keys are selected by the
+// "kid" header, so old keys can keep verifying while a new key signs.
+type JWTKey struct {
+	Id        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// NewHMACKey returns a HS256 key.
+func NewHMACKey(id string, secret []byte) JWTKey {
+	return JWTKey{
+		Id:        id,
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}
+}
+
+// NewRSAKey returns a RS256 key from PEM encoded keys. The private key may be
+// nil for keys that are only used to verify.
+func NewRSAKey(id string, privatePEM, publicPEM []byte) (JWTKey, error) {
+	var key = JWTKey{Id: id, Method: jwt.SigningMethodRS256}
+
+	if len(privatePEM) > 0 {
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+
+		if err != nil {
+			return key, err
+		}
+
+		key.SignKey = private
+		key.VerifyKey = &private.PublicKey
+	}
+
+	if len(publicPEM) > 0 {
+		public, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+
+		if err != nil {
+			return key, err
+		}
+
+		key.VerifyKey = public
+	}
+
+	if _, ok := key.VerifyKey.(*rsa.PublicKey); !ok {
+		return key, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// JWTClaims are the claims of the tokens issued by JWTConfig.
+type JWTClaims struct {
+	Scopes []string `json:"scopes,omitempty"`
+	jwt.StandardClaims
+}
+
+// JWTConfig signs and verifies tokens.
+type JWTConfig struct {
+	// Keys verify tokens, the first key also signs new tokens.
+	Keys []JWTKey
+	// Issuer is set on new tokens and required on verified tokens if not empty.
+	Issuer string
+	// TTL is the lifetime of new tokens. Default one hour.
+	TTL time.Duration
+}
+
+// Issue returns a signed token for the user with the given scopes.
+func (self *JWTConfig) Issue(user IUser, scopes ...string) (string, error) {
+	if len(self.Keys) == 0 || self.Keys[0].SignKey == nil {
+		return "", ErrUnknownKey
+	}
+
+	var ttl = self.TTL
+
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+
+	var now = time.Now()
+	var key = self.Keys[0]
+
+	token := jwt.NewWithClaims(key.Method, &JWTClaims{
+		Scopes: scopes,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   conv.String(user.GetId()),
+			Issuer:    self.Issuer,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	})
+
+	if key.Id != "" {
+		token.Header["kid"] = key.Id
+	}
+
+	return token.SignedString(key.SignKey)
+}
+
+// Parse verifies the token and returns its claims.
+func (self *JWTConfig) Parse(tokenString string) (*JWTClaims, error) {
+	var claims = new(JWTClaims)
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key, ok := self.key(token)
+
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+
+		// never let the token choose the algorithm, e.g. HS256 with a RSA public key
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+
+		return key.VerifyKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if self.Issuer != "" && !claims.VerifyIssuer(self.Issuer, true) {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (self *JWTConfig) key(token *jwt.Token) (JWTKey, bool) {
+	kid, _ := token.Header["kid"].(string)
+
+	for _, key := range self.Keys {
+		if key.Id == kid {
+			return key, true
+		}
+	}
+
+	return JWTKey{}, false
+}
+
+// HasScope reports whether the claims grant the scope. The "*" scope grants all.
+func (self *JWTClaims) HasScope(scope string) bool {
+	return hasScope(self.Scopes, scope)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"github.com/labstack/echo"
+)
+
+// IScopedGuard is implemented by guards whose credentials carry scopes.
+type IScopedGuard interface {
+	IGuard
+	// HasScope reports whether the credentials of the request grant the scope.
+	HasScope(scope string) bool
+}
+
+// JWTGuard authenticates requests with a bearer JSON web token. The subject
+// claim is the user ID.
+type JWTGuard struct {
+	Config *JWTConfig
+
+	name     string
+	provider IUserProvider
+	context  echo.Context
+	user     IUser
+	claims   *JWTClaims
+	resolved bool
+}
+
+func NewJWTGuard(name string, config *JWTConfig, provider IUserProvider, context echo.Context) *JWTGuard {
+	return &JWTGuard{
+		Config:   config,
+		name:     name,
+		provider: provider,
+		context:  context,
+	}
+}
+
+func (self *JWTGuard) Name() string {
+	return self.name
+}
+
+func (self *JWTGuard) Check() bool {
+	return self.User() != nil
+}
+
+func (self *JWTGuard) Guest() bool {
+	return !self.Check()
+}
+
+func (self *JWTGuard) User() IUser {
+	if self.resolved {
+		return self.user
+	}
+
+	self.resolved = true
+
+	token := bearerToken(self.context)
+
+	if token == "" {
+		return nil
+	}
+
+	claims, err := self.Config.Parse(token)
+
+	if err != nil {
+		return nil
+	}
+
+	if user, err := self.provider.RetrieveById(claims.Subject); err == nil && user != nil {
+		self.user = user
+		self.claims = claims
+	}
+
+	return self.user
+}
+
+func (self *JWTGuard) ID() interface{} {
+	if user := self.User(); user != nil {
+		return user.GetId()
+	}
+
+	return nil
+}
+
+// Claims returns the claims of the request token, or nil.
+func (self *JWTGuard) Claims() *JWTClaims {
+	self.User()
+
+	return self.claims
+}
+
+func (self *JWTGuard) HasScope(scope string) bool {
+	if claims := self.Claims(); claims != nil {
+		return claims.HasScope(scope)
+	}
+
+	return false
+}
+
+func (self *JWTGuard) Validate(credentials Credentials) bool {
+	_, err := attempt(self.provider, credentials)
+
+	return err == nil
+}
+
+// Attempt checks the credentials and sets the user for the current request,
+// use Issue to hand a token to the client.
+func (self *JWTGuard) Attempt(credentials Credentials) error {
+	user, err := attempt(self.provider, credentials)
+
+	if err != nil {
+		return err
+	}
+
+	return self.Login(user)
+}
+
+// Issue returns a token for the user.
+func (self *JWTGuard) Issue(user IUser, scopes ...string) (string, error) {
+	return self.Config.Issue(user, scopes...)
+}
+
+// Login sets the user for the current request only.
+func (self *JWTGuard) Login(user IUser) error {
+	self.user = user
+	self.claims = nil
+	self.resolved = true
+
+	return nil
+}
+
+func (self *JWTGuard) Logout() error {
+	self.user = nil
+	self.claims = nil
+	self.resolved = true
+
+	return nil
+}
+
+// Challenge tells the client to send a bearer token.
+func (self *JWTGuard) Challenge() {
+	self.context.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// IChallenger is implemented by guards that tell rejected clients how to
+// authenticate, e.g. with a WWW-Authenticate header.
+type IChallenger interface {
+	Challenge()
+}
+
+// Middleware rejects requests that none of the guards authenticate. The first
+// guard that authenticates the request becomes the default guard.
+// Without guard names the default guard is used.
+func Middleware(guardNames ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			manager := Default(context)
+			names := guardNames
+
+			if len(names) == 0 {
+				names = []string{manager.defaultGuard}
+			}
+
+			for _, name := range names {
+				if guard := manager.Guard(name); guard != nil && guard.Check() {
+					manager.ShouldUse(name)
+
+					return next(context)
+				}
+			}
+
+			for _, name := range names {
+				if guard, ok := manager.Guard(name).(IChallenger); ok {
+					guard.Challenge()
+				}
+			}
+
+			return echo.ErrUnauthorized
+		}
+	}
+}
+
+// RequireScopes rejects requests whose token does not grant all scopes.
+// It must run after Middleware so the token guard is the default guard.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			guard, ok := Default(context).Guard().(IScopedGuard)
+
+			if !ok || guard.Guest() {
+				return echo.ErrUnauthorized
+			}
+
+			for _, scope := range scopes {
+				if !guard.HasScope(scope) {
+					return echo.NewHTTPError(http.StatusForbidden, "missing scope "+scope)
+				}
+			}
+
+			return next(context)
+		}
+	}
+}
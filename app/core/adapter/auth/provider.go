@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/model"
+)
+
+// IUserProvider looks users up for the guards.
+type IUserProvider interface {
+	// RetrieveById returns the user with the given identifier.
+	RetrieveById(id interface{}) (IUser, error)
+	// RetrieveByCredentials returns the user matching all credentials but the password.
+	RetrieveByCredentials(credentials Credentials) (IUser, error)
+	// ValidateCredentials checks the password of the credentials against the user.
+	ValidateCredentials(user IUser, credentials Credentials) bool
+}
+
+// IPasswordRehasher is implemented by providers that can replace the stored
+// password hash. Guards call it after a successful login, so hashes follow
+// changes of the hasher or its cost parameters.
+type IPasswordRehasher interface {
+	RehashPasswordIfRequired(user IUser, password string) error
+}
+
+// IModelUser is a user stored in a database table.
+type IModelUser interface {
+	IUser
+	model.IModel
+}
+
+// GormUserProvider retrieves users through model.Model.
+type GormUserProvider struct {
+	// New returns an empty user to scan into, e.g. func() auth.IModelUser { return new(User) }
+	New func() IModelUser
+	// IdColumn is the column matched by RetrieveById. Default "id".
+	IdColumn string
+	// PasswordColumn is the column holding the password hash. Default "password".
+	PasswordColumn string
+	// RecoveryCodesColumn holds the hashed two factor recovery codes, one per line.
+	// Default "two_factor_recovery_codes".
+	RecoveryCodesColumn string
+	// VerifiedColumn holds the time the email address was verified. Default "email_verified_at".
+	VerifiedColumn string
+}
+
+func NewGormUserProvider(newUser func() IModelUser) *GormUserProvider {
+	return &GormUserProvider{
+		New:                 newUser,
+		IdColumn:            "id",
+		PasswordColumn:      "password",
+		RecoveryCodesColumn: "two_factor_recovery_codes",
+		VerifiedColumn:      "email_verified_at",
+	}
+}
+
+func (self *GormUserProvider) RetrieveById(id interface{}) (IUser, error) {
+	user := self.New()
+
+	if err := new(model.Model).With(user).Where(map[string]interface{}{self.IdColumn: id}).First(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (self *GormUserProvider) RetrieveByCredentials(credentials Credentials) (IUser, error) {
+	var wheres = make(map[string]interface{})
+
+	for key, value := range credentials {
+		if key != PasswordKey {
+			wheres[key] = value
+		}
+	}
+
+	if len(wheres) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	user := self.New()
+
+	if err := new(model.Model).With(user).Where(wheres).First(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (self *GormUserProvider) ValidateCredentials(user IUser, credentials Credentials) bool {
+	password, ok := credentials[PasswordKey]
+
+	if !ok {
+		return false
+	}
+
+	return CheckPassword(password, user.GetPassword())
+}
+
+func (self *GormUserProvider) RehashPasswordIfRequired(user IUser, password string) error {
+	if !GetHasher().NeedsRehash(user.GetPassword()) {
+		return nil
+	}
+
+	hashed, err := HashPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	return self.UpdatePassword(user, hashed)
+}
+
+// ChangePassword hashes and stores a new password and revokes the remember
+// me tokens of the user, so other devices have to log in again.
+func (self *GormUserProvider) ChangePassword(user IUser, password string) error {
+	hashed, err := HashPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	if err := self.UpdatePassword(user, hashed); err != nil {
+		return err
+	}
+
+	return RevokeRememberTokens(user)
+}
+
+// UpdatePassword stores the password hash of the user.
+func (self *GormUserProvider) UpdatePassword(user IUser, hashed string) error {
+	modelUser, ok := user.(IModelUser)
+
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	return new(model.Model).With(modelUser).Where(map[string]interface{}{self.IdColumn: user.GetId()}).Update(self.PasswordColumn, hashed).Error
+}
+
+// SaveRecoveryCodes stores the remaining hashed recovery codes of the user, one per line.
+func (self *GormUserProvider) SaveRecoveryCodes(user IUser, hashed []string) error {
+	modelUser, ok := user.(IModelUser)
+
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	return new(model.Model).With(modelUser).Where(map[string]interface{}{self.IdColumn: user.GetId()}).Update(self.RecoveryCodesColumn, strings.Join(hashed, "\n")).Error
+}
+
+// MarkEmailVerified stores the current time as the verification time of the user.
+func (self *GormUserProvider) MarkEmailVerified(user IUser) error {
+	modelUser, ok := user.(IModelUser)
+
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	return new(model.Model).With(modelUser).Where(map[string]interface{}{self.IdColumn: user.GetId()}).Update(self.VerifiedColumn, time.Now()).Error
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/database"
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/labstack/echo"
+)
+
+var ErrInvalidRememberToken = errors.New("auth: invalid remember token")
+
+// EventRememberMismatch is emitted with a *RememberEvent when a remember
+// cookie has a known selector but a wrong validator. Only that token is
+// revoked, listeners may revoke the other devices of the user as well.
+const EventRememberMismatch = "auth.remember.mismatch"
+
+// RememberEvent is the payload of EventRememberMismatch.
+type RememberEvent struct {
+	Guard    string
+	UserId   string
+	Selector string
+	IP       string
+	Context  echo.Context
+}
+
+// DefaultRememberLifetime is how long a remember me cookie keeps a user logged in.
+var DefaultRememberLifetime = 30 * 24 * time.Hour
+
+// RememberGracePeriod is how long a rotated remember token still logs the
+// user in, so concurrent requests with the same cookie do not log out.
+var RememberGracePeriod = 30 * time.Second
+
+// RememberToken is a persistent login token. The cookie holds
+// "<selector>:<validator>", only the SHA-256 of the validator is stored,
+// so a leaked table can not be used to log in.
+type RememberToken struct {
+	Id        uint   `gorm:"primary_key"`
+	Guard     string `gorm:"size:64"`
+	UserId    string `gorm:"size:64;index"`
+	Selector  string `gorm:"size:32;unique_index"`
+	Validator string `gorm:"size:64"`
+	// Rotated tokens were replaced by a new one and are only valid for
+	// RememberGracePeriod.
+	Rotated   bool
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+func (self *RememberToken) TableName() string {
+	return "remember_tokens"
+}
+
+func (self *RememberToken) isExpired() bool {
+	return time.Now().After(self.ExpiresAt)
+}
+
+// IRememberPruner is implemented by repositories that can delete the
+// expired tokens, see PruneRememberTokens.
+type IRememberPruner interface {
+	DeleteExpired() error
+}
+
+// IRememberRepository stores remember tokens.
+type IRememberRepository interface {
+	Create(token *RememberToken) error
+	Find(selector string) (*RememberToken, error)
+	Delete(selector string) error
+	// DeleteByUser revokes all remember tokens of the user.
+	DeleteByUser(userId string) error
+}
+
+var (
+	rememberMutex      sync.RWMutex
+	rememberRepository IRememberRepository = new(GormRememberRepository)
+)
+
+// SetRememberRepository sets where remember tokens are stored.
+func SetRememberRepository(repository IRememberRepository) {
+	rememberMutex.Lock()
+	rememberRepository = repository
+	rememberMutex.Unlock()
+}
+
+func GetRememberRepository() IRememberRepository {
+	rememberMutex.RLock()
+	defer rememberMutex.RUnlock()
+
+	return rememberRepository
+}
+
+// RevokeRememberTokens logs the user out of every device that was remembered,
+// e.g. after the password changed.
+func RevokeRememberTokens(user IUser) error {
+	return GetRememberRepository().DeleteByUser(conv.String(user.GetId()))
+}
+
+// PruneRememberTokens deletes the expired remember tokens, if the repository
+// supports it. Expired tokens are also pruned when one is used.
+func PruneRememberTokens() error {
+	if pruner, ok := GetRememberRepository().(IRememberPruner); ok {
+		return pruner.DeleteExpired()
+	}
+
+	return nil
+}
+
+// newRememberToken returns a token and the cookie value that belongs to it.
+func newRememberToken(guard string, userId interface{}, lifetime time.Duration) (*RememberToken, string, error) {
+	selector, err := randomString(12)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	validator, err := randomString(32)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &RememberToken{
+		Guard:     guard,
+		UserId:    conv.String(userId),
+		Selector:  selector,
+		Validator: hashToken(validator),
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+
+	return token, selector + ":" + validator, nil
+}
+
+func splitRememberCookie(value string) (string, string, error) {
+	var parts = strings.SplitN(value, ":", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrInvalidRememberToken
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func (self *RememberToken) matches(validator string) bool {
+	return subtle.ConstantTimeCompare([]byte(self.Validator), []byte(hashToken(validator))) == 1
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(length int) (string, error) {
+	var b = make([]byte, length)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GormRememberRepository stores remember tokens in the remember_tokens table.
+type GormRememberRepository struct{}
+
+func (self *GormRememberRepository) Create(token *RememberToken) error {
+	return database.DB.Create(token).Error
+}
+
+func (self *GormRememberRepository) Find(selector string) (*RememberToken, error) {
+	var token = new(RememberToken)
+
+	if err := database.DB.Where("selector = ?", selector).First(token).Error; err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (self *GormRememberRepository) Delete(selector string) error {
+	return database.DB.Where("selector = ?", selector).Delete(RememberToken{}).Error
+}
+
+func (self *GormRememberRepository) DeleteByUser(userId string) error {
+	return database.DB.Where("user_id = ?", userId).Delete(RememberToken{}).Error
+}
+
+func (self *GormRememberRepository) DeleteExpired() error {
+	return database.DB.Where("expires_at < ?", time.Now()).Delete(RememberToken{}).Error
+}
+
+// MemoryRememberRepository keeps remember tokens in memory, for tests.
+type MemoryRememberRepository struct {
+	mutex  sync.RWMutex
+	tokens map[string]RememberToken
+}
+
+func NewMemoryRememberRepository() *MemoryRememberRepository {
+	return &MemoryRememberRepository{tokens: make(map[string]RememberToken)}
+}
+
+func (self *MemoryRememberRepository) Create(token *RememberToken) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	token.CreatedAt = time.Now()
+	self.tokens[token.Selector] = *token
+
+	return nil
+}
+
+func (self *MemoryRememberRepository) Find(selector string) (*RememberToken, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if token, ok := self.tokens[selector]; ok {
+		return &token, nil
+	}
+
+	return nil, ErrInvalidRememberToken
+}
+
+func (self *MemoryRememberRepository) Delete(selector string) error {
+	self.mutex.Lock()
+	delete(self.tokens, selector)
+	self.mutex.Unlock()
+
+	return nil
+}
+
+func (self *MemoryRememberRepository) DeleteByUser(userId string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for selector, token := range self.tokens {
+		if token.UserId == userId {
+			delete(self.tokens, selector)
+		}
+	}
+
+	return nil
+}
+
+func (self *MemoryRememberRepository) DeleteExpired() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for selector, token := range self.tokens {
+		if token.isExpired() {
+			delete(self.tokens, selector)
+		}
+	}
+
+	return nil
+}
+
+// Tokens returns the stored tokens of the user.
+func (self *MemoryRememberRepository) Tokens(userId string) []RememberToken {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var tokens []RememberToken
+
+	for _, token := range self.tokens {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
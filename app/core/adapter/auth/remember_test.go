@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/dulumao/Guten-utils/os/event"
+	"github.com/labstack/echo"
+)
+
+// storedIdProvider finds users by the string IDs stored with tokens, like a
+// lookup in the database does.
+type storedIdProvider struct {
+	*testProvider
+}
+
+func (self *storedIdProvider) RetrieveById(id interface{}) (IUser, error) {
+	return self.testProvider.RetrieveById(conv.Int(id))
+}
+
+func rememberCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "remember_web" {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+func TestSessionGuard_Remember(t *testing.T) {
+	repository := NewMemoryRememberRepository()
+	SetRememberRepository(repository)
+	defer SetRememberRepository(new(GormRememberRepository))
+
+	store := session.NewMemoryStore([]byte("secret"))
+	provider := &storedIdProvider{&testProvider{users: []*testUser{{id: 1, email: "a@b.c", password: "secret"}}}}
+	app := newTestApp(store, provider)
+
+	app.POST("/login", func(c echo.Context) error {
+		return Default(c).AttemptRemember(Credentials{"email": "a@b.c", PasswordKey: "secret"})
+	})
+	app.GET("/me", func(c echo.Context) error {
+		if !Default(c).Check() {
+			return echo.ErrUnauthorized
+		}
+
+		if !Default(c).Guard().(IRememberGuard).ViaRemember() {
+			t.Error("expect login via remember cookie")
+		}
+
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+	first := rememberCookie(rec)
+
+	if first == nil || len(repository.Tokens("1")) != 1 {
+		t.Fatal("expect a remember cookie and token")
+	}
+
+	// the session is gone, only the remember cookie is sent
+	store.Flush()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(first)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", rec.Code)
+	}
+
+	second := rememberCookie(rec)
+
+	if second == nil || second.Value == first.Value {
+		t.Fatal("expect the remember token to be rotated")
+	}
+
+	// a concurrent request with the rotated token is still logged in,
+	// without rotating it again
+	store.Flush()
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(first)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rememberCookie(rec) != nil {
+		t.Errorf("expect 200 without a new cookie in the grace period, got %d", rec.Code)
+	}
+
+	// after the grace period the rotated token can not be used again
+	RememberGracePeriod = -time.Second
+	defer func() { RememberGracePeriod = 30 * time.Second }()
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+	used := rememberCookie(rec)
+
+	store.Flush()
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(used)
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	store.Flush()
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(used)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expect 401 for a used token, got %d", rec.Code)
+	}
+
+	if len(repository.Tokens("1")) != 3 {
+		t.Errorf("expect the expired token to be pruned, got %d tokens", len(repository.Tokens("1")))
+	}
+
+	// a tampered validator revokes only its token and is reported
+	var mismatch *RememberEvent
+
+	observer.On(EventRememberMismatch, event.Listener{Callback: func(e *event.Event) error {
+		mismatch = e.Data.(*RememberEvent)
+		return nil
+	}})
+	defer observer.New()
+
+	selector, _, _ := splitRememberCookie(second.Value)
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "remember_web", Value: selector + ":forged"})
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized || len(repository.Tokens("1")) != 2 {
+		t.Errorf("expect a forged validator to revoke only its token, %d tokens left", len(repository.Tokens("1")))
+	}
+
+	if mismatch == nil || mismatch.UserId != "1" || mismatch.Selector != selector {
+		t.Errorf("expect the mismatch to be emitted, got %+v", mismatch)
+	}
+}
+
+func TestRevokeRememberTokens(t *testing.T) {
+	repository := NewMemoryRememberRepository()
+	SetRememberRepository(repository)
+	defer SetRememberRepository(new(GormRememberRepository))
+
+	for i := 0; i < 3; i++ {
+		token, _, _ := newRememberToken("web", 7, DefaultRememberLifetime)
+		repository.Create(token)
+	}
+
+	if err := RevokeRememberTokens(&testUser{id: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repository.Tokens("7")) != 0 {
+		t.Error("expect all tokens to be revoked")
+	}
+}
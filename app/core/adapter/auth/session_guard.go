@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/labstack/echo"
+)
+
+// IRememberGuard is implemented by guards that can keep a user logged in
+// after the session expired.
+type IRememberGuard interface {
+	IGuard
+	// AttemptRemember is Attempt followed by setting a remember me cookie.
+	AttemptRemember(credentials Credentials) error
+	// LoginRemember logs the user in and sets a remember me cookie.
+	LoginRemember(user IUser) error
+	// ViaRemember reports whether the user was logged in by the remember me cookie.
+	ViaRemember() bool
+	// LogoutEverywhere logs out and revokes the remember tokens of all devices.
+	LogoutEverywhere() error
+}
+
+// SessionGuard keeps the user ID in the session under "auth_"+name.
+// With a remember me cookie it logs the user in again when the session is gone.
+type SessionGuard struct {
+	// RememberLifetime is how long the remember me cookie is valid.
+	RememberLifetime time.Duration
+	// CookieSecure marks the remember me cookie as secure.
+	CookieSecure bool
+
+	name        string
+	provider    IUserProvider
+	context     echo.Context
+	user        IUser
+	resolved    bool
+	viaRemember bool
+}
+
+func NewSessionGuard(name string, provider IUserProvider, context echo.Context) *SessionGuard {
+	return &SessionGuard{
+		RememberLifetime: DefaultRememberLifetime,
+		name:             name,
+		provider:         provider,
+		context:          context,
+	}
+}
+
+func (self *SessionGuard) Name() string {
+	return self.name
+}
+
+func (self *SessionGuard) sessionKey() string {
+	return "auth_" + self.name
+}
+
+func (self *SessionGuard) rememberCookieName() string {
+	return "remember_" + self.name
+}
+
+func (self *SessionGuard) Check() bool {
+	return self.User() != nil
+}
+
+func (self *SessionGuard) Guest() bool {
+	return !self.Check()
+}
+
+// User returns the logged in user, nil while the second factor is pending.
+func (self *SessionGuard) User() IUser {
+	if self.TwoFactorPending() {
+		return nil
+	}
+
+	return self.resolve()
+}
+
+// PendingUser returns the user that logged in with the password but has
+// not yet entered the second factor, nil if there is none.
+func (self *SessionGuard) PendingUser() IUser {
+	if !self.TwoFactorPending() {
+		return nil
+	}
+
+	return self.resolve()
+}
+
+// resolve returns the user of the session or the remember me cookie,
+// whether or not the second factor is pending.
+func (self *SessionGuard) resolve() IUser {
+	if self.resolved {
+		return self.user
+	}
+
+	self.resolved = true
+
+	sess := session.Default(self.context)
+
+	if sess == nil {
+		return nil
+	}
+
+	if id := sess.Get(self.sessionKey()); id != nil {
+		if user, err := self.provider.RetrieveById(id); err == nil {
+			self.user = user
+		}
+	}
+
+	if self.user == nil {
+		self.userFromRemember()
+	}
+
+	return self.user
+}
+
+// userFromRemember logs the user in from the remember me cookie and rotates
+// the token, so a stolen cookie can only be used once. The rotated token is
+// valid for RememberGracePeriod, requests sent with it meanwhile log the
+// user in without rotating it again.
+func (self *SessionGuard) userFromRemember() {
+	cookie, err := self.context.Cookie(self.rememberCookieName())
+
+	if err != nil || cookie.Value == "" {
+		return
+	}
+
+	selector, validator, err := splitRememberCookie(cookie.Value)
+
+	if err != nil {
+		self.forgetRememberCookie()
+		return
+	}
+
+	repository := GetRememberRepository()
+	token, err := repository.Find(selector)
+
+	if err != nil || token.Guard != self.name {
+		self.forgetRememberCookie()
+		return
+	}
+
+	if !token.matches(validator) {
+		// the selector is known but the validator does not match: the cookie
+		// was tampered with. Revoking every device would let anyone knowing a
+		// selector log the user out, so only this token is revoked.
+		repository.Delete(selector)
+		self.forgetRememberCookie()
+
+		observer.Emit(EventRememberMismatch, &RememberEvent{
+			Guard:    self.name,
+			UserId:   token.UserId,
+			Selector: selector,
+			IP:       self.context.RealIP(),
+			Context:  self.context,
+		})
+
+		return
+	}
+
+	if token.isExpired() {
+		repository.Delete(selector)
+		PruneRememberTokens()
+		self.forgetRememberCookie()
+		return
+	}
+
+	user, err := self.provider.RetrieveById(token.UserId)
+
+	if err != nil || user == nil {
+		self.forgetRememberCookie()
+		return
+	}
+
+	if token.Rotated {
+		if err := self.Login(user); err != nil {
+			return
+		}
+	} else {
+		// keep the old token for the grace period
+		repository.Delete(selector)
+		token.Id = 0
+		token.Rotated = true
+		token.ExpiresAt = time.Now().Add(RememberGracePeriod)
+
+		// a concurrent request with the same cookie may have stored it first
+		if err := repository.Create(token); err != nil {
+			if _, err := repository.Find(selector); err != nil {
+				self.forgetRememberCookie()
+				return
+			}
+		}
+
+		if err := self.LoginRemember(user); err != nil {
+			return
+		}
+	}
+
+	self.viaRemember = true
+}
+
+func (self *SessionGuard) ID() interface{} {
+	if user := self.User(); user != nil {
+		return user.GetId()
+	}
+
+	return nil
+}
+
+func (self *SessionGuard) Validate(credentials Credentials) bool {
+	_, err := attempt(self.provider, credentials)
+
+	return err == nil
+}
+
+func (self *SessionGuard) Attempt(credentials Credentials) error {
+	user, err := attempt(self.provider, credentials)
+
+	if err != nil {
+		return err
+	}
+
+	return self.Login(user)
+}
+
+// AttemptRemember is Attempt followed by setting a remember me cookie.
+func (self *SessionGuard) AttemptRemember(credentials Credentials) error {
+	user, err := attempt(self.provider, credentials)
+
+	if err != nil {
+		return err
+	}
+
+	return self.LoginRemember(user)
+}
+
+// Login stores the user in the session under a new session ID, so an ID
+// planted before the login does not become authenticated.
+func (self *SessionGuard) Login(user IUser) error {
+	sess := session.Default(self.context)
+
+	if sess == nil {
+		return ErrNoSession
+	}
+
+	if regenerator, ok := sess.(session.IRegenerator); ok {
+		if err := regenerator.Regenerate(); err != nil {
+			return err
+		}
+	}
+
+	sess.Set(self.sessionKey(), user.GetId())
+	self.markTwoFactorPending(sess, user)
+
+	if err := sess.Save(); err != nil {
+		return err
+	}
+
+	self.user = user
+	self.resolved = true
+
+	return nil
+}
+
+func (self *SessionGuard) LoginRemember(user IUser) error {
+	if err := self.Login(user); err != nil {
+		return err
+	}
+
+	token, value, err := newRememberToken(self.name, user.GetId(), self.RememberLifetime)
+
+	if err != nil {
+		return err
+	}
+
+	if err := GetRememberRepository().Create(token); err != nil {
+		return err
+	}
+
+	self.context.SetCookie(&http.Cookie{
+		Name:     self.rememberCookieName(),
+		Value:    value,
+		Path:     "/",
+		Expires:  token.ExpiresAt,
+		MaxAge:   int(self.RememberLifetime / time.Second),
+		Secure:   self.CookieSecure,
+		HttpOnly: true,
+	})
+
+	return nil
+}
+
+func (self *SessionGuard) ViaRemember() bool {
+	return self.viaRemember
+}
+
+func (self *SessionGuard) Logout() error {
+	if cookie, err := self.context.Cookie(self.rememberCookieName()); err == nil {
+		if selector, _, err := splitRememberCookie(cookie.Value); err == nil {
+			GetRememberRepository().Delete(selector)
+		}
+
+		self.forgetRememberCookie()
+	}
+
+	self.user = nil
+	self.resolved = true
+	self.viaRemember = false
+
+	sess := session.Default(self.context)
+
+	if sess == nil {
+		return ErrNoSession
+	}
+
+	sess.Delete(self.sessionKey())
+	sess.Delete(self.twoFactorKey())
+
+	return sess.Save()
+}
+
+func (self *SessionGuard) LogoutEverywhere() error {
+	if user := self.resolve(); user != nil {
+		if err := RevokeRememberTokens(user); err != nil {
+			return err
+		}
+	}
+
+	return self.Logout()
+}
+
+func (self *SessionGuard) forgetRememberCookie() {
+	self.context.SetCookie(&http.Cookie{
+		Name:     self.rememberCookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		Secure:   self.CookieSecure,
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	stdContext "context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/labstack/echo"
+)
+
+const (
+	// EventFailed is emitted with a *ThrottleEvent after a failed login.
+	EventFailed = "auth.failed"
+	// EventLockout is emitted with a *ThrottleEvent when a login is locked out.
+	EventLockout = "auth.lockout"
+
+	// LockoutKey is the context key holding the remaining lockout seconds.
+	LockoutKey = "auth_lockout"
+)
+
+var ErrTooManyAttempts = errors.New("auth: too many login attempts")
+
+var (
+	// MaxAttempts is the number of failed logins allowed per username and IP
+	// within DecayTime. 0 or less disables throttling, max_attempts of
+	// env.toml disables it with a negative value, 0 there keeps this default.
+	MaxAttempts = 5
+	// DecayTime is how long failed logins are counted and how long a lockout lasts.
+	DecayTime = time.Minute
+)
+
+// ThrottleEvent is the payload of the EventFailed and EventLockout events.
+type ThrottleEvent struct {
+	Key      string
+	Username string
+	IP       string
+	Attempts int
+	// Seconds until the lockout ends, 0 if not locked out.
+	Seconds int
+	Context echo.Context
+}
+
+type throttle struct {
+	context  echo.Context
+	username string
+	key      string
+}
+
+func newThrottle(context echo.Context, credentials Credentials) *throttle {
+	var keys []string
+
+	for key := range credentials {
+		if key != PasswordKey {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var values = make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		values = append(values, strings.ToLower(credentials[key]))
+	}
+
+	var username = strings.Join(values, "|")
+	var ip string
+
+	if context != nil {
+		ip = context.RealIP()
+	}
+
+	return &throttle{
+		context:  context,
+		username: username,
+		key:      "auth:throttle:" + hashToken(username+"|"+ip),
+	}
+}
+
+func (self *throttle) enabled() bool {
+	return MaxAttempts > 0 && cache.Store != nil
+}
+
+func (self *throttle) ctx() stdContext.Context {
+	if self.context != nil && self.context.Request() != nil {
+		return self.context.Request().Context()
+	}
+
+	return stdContext.Background()
+}
+
+// availableIn returns the seconds until the lockout ends, 0 if not locked out.
+func (self *throttle) availableIn() int {
+	if !self.enabled() {
+		return 0
+	}
+
+	var until int64
+	cache.Store.Get(self.ctx(), self.key+":timer", &until)
+	seconds := until - time.Now().Unix()
+
+	if seconds <= 0 {
+		return 0
+	}
+
+	return int(seconds)
+}
+
+func (self *throttle) tooManyAttempts() bool {
+	return self.availableIn() > 0
+}
+
+func (self *throttle) hit() {
+	if !self.enabled() {
+		return
+	}
+
+	attempts, err := cache.Store.Increment(self.ctx(), self.key, 1, DecayTime)
+
+	if err != nil {
+		return
+	}
+
+	self.emit(EventFailed, int(attempts), 0)
+
+	if int(attempts) >= MaxAttempts {
+		until := time.Now().Add(DecayTime)
+		cache.Store.Set(self.ctx(), self.key+":timer", until.Unix(), DecayTime)
+		cache.Store.Forget(self.ctx(), self.key)
+
+		self.lockout(int(attempts))
+	}
+}
+
+func (self *throttle) clear() {
+	if !self.enabled() {
+		return
+	}
+
+	cache.Store.Forget(self.ctx(), self.key, self.key+":timer")
+}
+
+func (self *throttle) lockout(attempts int) {
+	seconds := self.availableIn()
+
+	if self.context != nil {
+		self.context.Set(LockoutKey, seconds)
+	}
+
+	self.emit(EventLockout, attempts, seconds)
+}
+
+func (self *throttle) emit(name string, attempts int, seconds int) {
+	var ip string
+
+	if self.context != nil {
+		ip = self.context.RealIP()
+	}
+
+	observer.Emit(name, &ThrottleEvent{
+		Key:      self.key,
+		Username: self.username,
+		IP:       ip,
+		Attempts: attempts,
+		Seconds:  seconds,
+		Context:  self.context,
+	})
+}
+
+// throttled runs a login attempt unless the username and IP are locked out.
+func (self *AuthManager) throttled(credentials Credentials, attempt func() error) error {
+	t := newThrottle(self.context, credentials)
+
+	if t.tooManyAttempts() {
+		t.lockout(0)
+
+		return ErrTooManyAttempts
+	}
+
+	err := attempt()
+
+	if err == ErrInvalidCredentials {
+		t.hit()
+
+		if t.tooManyAttempts() {
+			return ErrTooManyAttempts
+		}
+	} else if err == nil {
+		t.clear()
+	}
+
+	return err
+}
+
+// LockoutSeconds returns how long logins with the credentials from the
+// current IP are locked out, 0 if they are not.
+func (self *AuthManager) LockoutSeconds(credentials Credentials) int {
+	return newThrottle(self.context, credentials).availableIn()
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// TokenGuard is a stateless guard that looks the user up by the token sent
+// with every request, either as the InputKey query/form value or as a
+// "Bearer" Authorization header.
+type TokenGuard struct {
+	// InputKey is the request parameter carrying the token.
+	InputKey string
+	// StorageKey is the column the token is stored in.
+	StorageKey string
+
+	name     string
+	provider IUserProvider
+	context  echo.Context
+	user     IUser
+	resolved bool
+}
+
+func NewTokenGuard(name string, provider IUserProvider, context echo.Context) *TokenGuard {
+	return &TokenGuard{
+		InputKey:   "api_token",
+		StorageKey: "api_token",
+		name:       name,
+		provider:   provider,
+		context:    context,
+	}
+}
+
+func (self *TokenGuard) Name() string {
+	return self.name
+}
+
+// Token returns the token sent with the request.
+func (self *TokenGuard) Token() string {
+	if token := self.context.QueryParam(self.InputKey); token != "" {
+		return token
+	}
+
+	if token := self.context.FormValue(self.InputKey); token != "" {
+		return token
+	}
+
+	return bearerToken(self.context)
+}
+
+// bearerToken returns the token of a "Bearer" Authorization header.
+func bearerToken(context echo.Context) string {
+	header := context.Request().Header.Get(echo.HeaderAuthorization)
+
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	return ""
+}
+
+func (self *TokenGuard) Check() bool {
+	return self.User() != nil
+}
+
+func (self *TokenGuard) Guest() bool {
+	return !self.Check()
+}
+
+func (self *TokenGuard) User() IUser {
+	if self.resolved {
+		return self.user
+	}
+
+	self.resolved = true
+
+	if token := self.Token(); token != "" {
+		if user, err := self.provider.RetrieveByCredentials(Credentials{self.StorageKey: token}); err == nil {
+			self.user = user
+		}
+	}
+
+	return self.user
+}
+
+func (self *TokenGuard) ID() interface{} {
+	if user := self.User(); user != nil {
+		return user.GetId()
+	}
+
+	return nil
+}
+
+func (self *TokenGuard) Validate(credentials Credentials) bool {
+	token, ok := credentials[self.InputKey]
+
+	if !ok || token == "" {
+		return false
+	}
+
+	user, err := self.provider.RetrieveByCredentials(Credentials{self.StorageKey: token})
+
+	return err == nil && user != nil
+}
+
+func (self *TokenGuard) Attempt(credentials Credentials) error {
+	token, ok := credentials[self.InputKey]
+
+	if !ok || token == "" {
+		return ErrInvalidCredentials
+	}
+
+	user, err := self.provider.RetrieveByCredentials(Credentials{self.StorageKey: token})
+
+	if err != nil || user == nil {
+		return ErrInvalidCredentials
+	}
+
+	return self.Login(user)
+}
+
+// Login sets the user for the current request only.
+func (self *TokenGuard) Login(user IUser) error {
+	self.user = user
+	self.resolved = true
+
+	return nil
+}
+
+func (self *TokenGuard) Logout() error {
+	self.user = nil
+	self.resolved = true
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"github.com/labstack/echo"
+)
+
+func TestJWTConfig_KeyRotation(t *testing.T) {
+	user := &testUser{id: 3}
+	old := &JWTConfig{Keys: []JWTKey{NewHMACKey("2019-01", []byte("old"))}}
+	rotated := &JWTConfig{Keys: []JWTKey{NewHMACKey("2019-06", []byte("new")), NewHMACKey("2019-01", []byte("old"))}}
+
+	token, err := old.Issue(user, "post.read")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := rotated.Parse(token)
+
+	if err != nil {
+		t.Fatalf("expect token of the old key to verify, got %v", err)
+	}
+
+	if claims.Subject != "3" || !claims.HasScope("post.read") || claims.HasScope("post.write") {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	if _, err := (&JWTConfig{Keys: rotated.Keys[:1]}).Parse(token); err == nil {
+		t.Error("expect token of a removed key to fail")
+	}
+}
+
+func TestJWTConfig_RejectsInvalid(t *testing.T) {
+	config := &JWTConfig{Keys: []JWTKey{NewHMACKey("k", []byte("secret"))}, Issuer: "guten", TTL: -time.Minute}
+	expired, _ := config.Issue(&testUser{id: 1})
+
+	if _, err := config.Parse(expired); err == nil {
+		t.Error("expect expired token to fail")
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, &JWTClaims{StandardClaims: jwt.StandardClaims{Subject: "1", Issuer: "guten"}})
+	none.Header["kid"] = "k"
+	unsigned, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	if _, err := config.Parse(unsigned); err == nil {
+		t.Error("expect unsigned token to fail")
+	}
+
+	config.TTL = time.Minute
+	config.Issuer = "other"
+	other, _ := config.Issue(&testUser{id: 1})
+	config.Issuer = "guten"
+
+	if _, err := config.Parse(other); err == nil {
+		t.Error("expect token of another issuer to fail")
+	}
+}
+
+func TestApiTokenGuard(t *testing.T) {
+	repository := NewMemoryApiTokenRepository()
+	SetApiTokenRepository(repository)
+	defer SetApiTokenRepository(new(GormApiTokenRepository))
+
+	user := &testUser{id: 5}
+	provider := &storedIdProvider{&testProvider{users: []*testUser{user}}}
+	app := newTestApp(session.NewMemoryStore([]byte("secret")), provider)
+	RegisterGuard("api", func(name string, c echo.Context) IGuard {
+		return NewApiTokenGuard(name, provider, c)
+	})
+
+	app.GET("/posts", func(c echo.Context) error {
+		return c.String(http.StatusOK, "5")
+	}, Middleware("api"), RequireScopes("post.read"))
+	app.POST("/posts", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	}, Middleware("api"), RequireScopes("post.write"))
+
+	plain, token, err := CreateApiToken(user, "cli", []string{"post.read"}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Token == plain {
+		t.Error("expect token to be stored hashed")
+	}
+
+	request := func(method, plain string) int {
+		req := httptest.NewRequest(method, "/posts", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+plain)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	if code := request(http.MethodGet, plain); code != http.StatusOK {
+		t.Errorf("expect 200, got %d", code)
+	}
+
+	if code := request(http.MethodPost, plain); code != http.StatusForbidden {
+		t.Errorf("expect 403 without scope, got %d", code)
+	}
+
+	if code := request(http.MethodGet, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expect 401, got %d", code)
+	}
+
+	expired, old, _ := CreateApiToken(user, "old", []string{"*"}, time.Minute)
+	past := time.Now().Add(-time.Second)
+	old.ExpiresAt = &past
+	repository.tokens[old.Id] = *old
+
+	if code := request(http.MethodGet, expired); code != http.StatusUnauthorized {
+		t.Errorf("expect 401 for expired token, got %d", code)
+	}
+}
+
+func TestJWTGuard(t *testing.T) {
+	config := &JWTConfig{Keys: []JWTKey{NewHMACKey("k", []byte("secret"))}}
+	provider := &storedIdProvider{&testProvider{users: []*testUser{{id: 9}}}}
+	app := newTestApp(session.NewMemoryStore([]byte("secret")), provider)
+	RegisterGuard("jwt", func(name string, c echo.Context) IGuard {
+		return NewJWTGuard(name, config, provider, c)
+	})
+
+	app.GET("/me", func(c echo.Context) error {
+		if Default(c).ID() != 9 {
+			t.Errorf("expect user 9, got %v", Default(c).ID())
+		}
+
+		return nil
+	}, Middleware("jwt"))
+
+	token, _ := config.Issue(&testUser{id: 9})
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expect 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me", nil))
+
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(echo.HeaderWWWAuthenticate) != "Bearer" {
+		t.Errorf("expect bearer challenge, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	"github.com/labstack/echo"
+)
+
+var ErrInvalidTwoFactorCode = errors.New("auth: invalid two factor code")
+
+var (
+	// TOTPPeriod is the lifetime of a code.
+	TOTPPeriod = 30 * time.Second
+	// TOTPDigits is the length of a code.
+	TOTPDigits = 6
+	// TOTPSkew is the number of periods before and after the current one that
+	// are accepted, to allow for clock drift between server and device.
+	TOTPSkew = 1
+)
+
+// ITwoFactorUser is implemented by users that can enable two factor authentication.
+type ITwoFactorUser interface {
+	IUser
+	// GetTwoFactorSecret returns the base32 TOTP secret, empty if two factor
+	// authentication is not enabled.
+	GetTwoFactorSecret() string
+	// GetRecoveryCodes returns the hashed unused recovery codes.
+	GetRecoveryCodes() []string
+}
+
+// IRecoveryCodeSaver is implemented by providers that can store the
+// remaining recovery codes after one was used.
+type IRecoveryCodeSaver interface {
+	SaveRecoveryCodes(user IUser, hashed []string) error
+}
+
+// GenerateTOTPSecret returns a new random base32 secret.
+func GenerateTOTPSecret() (string, error) {
+	var b = make([]byte, 20)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps read from a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	var query = url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	query.Set("period", fmt.Sprintf("%d", int(TOTPPeriod/time.Second)))
+
+	var label = url.PathEscape(issuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code of the secret at the given time.
+func TOTPCode(secret string, at time.Time) (string, error) {
+	return totpCode(secret, uint64(at.Unix()/int64(TOTPPeriod/time.Second)))
+}
+
+// VerifyTOTP reports whether the code is valid for the secret now, within TOTPSkew periods.
+func VerifyTOTP(secret, code string) bool {
+	_, ok := matchTOTP(secret, code)
+
+	return ok
+}
+
+// matchTOTP returns the counter of the period the code is valid for.
+func matchTOTP(secret, code string) (int64, bool) {
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	var counter = time.Now().Unix() / int64(TOTPPeriod/time.Second)
+	var matched int64
+	var valid = 0
+
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		expected, err := totpCode(secret, uint64(counter+int64(i)))
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			matched, valid = counter+int64(i), 1
+		}
+	}
+
+	return matched, valid == 1
+}
+
+// totpCode implements RFC 4226 HOTP with SHA-1, as used by RFC 6238.
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+
+	if err != nil {
+		return "", err
+	}
+
+	var msg = make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	var mod uint32 = 1
+
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// GenerateRecoveryCodes returns n plain codes to show to the user once and
+// their hashes to store.
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	var plain = make([]string, 0, n)
+	var hashed = make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		var b = make([]byte, 10)
+
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		code = code[:8] + "-" + code[8:]
+
+		plain = append(plain, code)
+		hashed = append(hashed, hashToken(code))
+	}
+
+	return plain, hashed, nil
+}
+
+// UseRecoveryCode returns the hashed codes without the used code, ok is false
+// if the code is not one of them.
+func UseRecoveryCode(hashed []string, code string) ([]string, bool) {
+	var sum = hashToken(strings.ToLower(strings.TrimSpace(code)))
+	var remaining = make([]string, 0, len(hashed))
+	var found = false
+
+	for _, h := range hashed {
+		if !found && subtle.ConstantTimeCompare([]byte(h), []byte(sum)) == 1 {
+			found = true
+			continue
+		}
+
+		remaining = append(remaining, h)
+	}
+
+	return remaining, found
+}
+
+func (self *SessionGuard) twoFactorKey() string {
+	return "auth_" + self.name + "_2fa_pending"
+}
+
+// TwoFactorPending reports whether the user logged in with the password but
+// has not yet entered the second factor.
+func (self *SessionGuard) TwoFactorPending() bool {
+	sess := session.Default(self.context)
+
+	if sess == nil || self.resolve() == nil {
+		return false
+	}
+
+	pending, _ := sess.Get(self.twoFactorKey()).(bool)
+
+	return pending
+}
+
+// VerifyTwoFactor completes a pending login with a TOTP code or a recovery
+// code. Failed codes are throttled per user like logins, ErrTooManyAttempts
+// once MaxAttempts codes failed within DecayTime. A TOTP code is accepted
+// once, later codes must be of a newer period.
+func (self *SessionGuard) VerifyTwoFactor(code string) error {
+	user, ok := self.resolve().(ITwoFactorUser)
+
+	if !ok || user.GetTwoFactorSecret() == "" {
+		return ErrInvalidTwoFactorCode
+	}
+
+	t := newTwoFactorThrottle(self.context, user)
+
+	if t.tooManyAttempts() {
+		t.lockout(0)
+
+		return ErrTooManyAttempts
+	}
+
+	if err := self.verifyTwoFactorCode(user, code, t); err != nil {
+		if err == ErrInvalidTwoFactorCode {
+			t.hit()
+
+			if t.tooManyAttempts() {
+				return ErrTooManyAttempts
+			}
+		}
+
+		return err
+	}
+
+	t.clear()
+
+	sess := session.Default(self.context)
+	sess.Delete(self.twoFactorKey())
+
+	return sess.Save()
+}
+
+func (self *SessionGuard) verifyTwoFactorCode(user ITwoFactorUser, code string, t *throttle) error {
+	if counter, ok := matchTOTP(user.GetTwoFactorSecret(), code); ok {
+		if !useTOTPCounter(t, user, counter) {
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	remaining, ok := UseRecoveryCode(user.GetRecoveryCodes(), code)
+
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	if saver, ok := self.provider.(IRecoveryCodeSaver); ok {
+		return saver.SaveRecoveryCodes(user, remaining)
+	}
+
+	return nil
+}
+
+// newTwoFactorThrottle counts the failed codes of the user from any IP.
+func newTwoFactorThrottle(context echo.Context, user IUser) *throttle {
+	var id = fmt.Sprint(user.GetId())
+
+	return &throttle{
+		context:  context,
+		username: id,
+		key:      "auth:throttle:2fa:" + hashToken(id),
+	}
+}
+
+// useTOTPCounter records the period of an accepted code in the cache and
+// reports whether it is newer than the last one of the user, so a code
+// seen by someone else can not be replayed. Without a cache codes are not
+// checked for replays.
+func useTOTPCounter(t *throttle, user IUser, counter int64) bool {
+	if cache.Store == nil {
+		return true
+	}
+
+	var key = "auth:2fa:counter:" + hashToken(fmt.Sprint(user.GetId()))
+	// older periods are outside the skew window
+	var ttl = time.Duration(2*TOTPSkew+2) * TOTPPeriod
+	var last int64
+
+	if err := cache.Store.Get(t.ctx(), key, &last); err == nil && counter <= last {
+		return false
+	}
+
+	// concurrent requests with the same code race for its period
+	if added, err := cache.Store.Add(t.ctx(), key+":"+strconv.FormatInt(counter, 10), true, ttl); err != nil || !added {
+		return false
+	}
+
+	cache.Store.Set(t.ctx(), key, counter, ttl)
+
+	return true
+}
+
+// markTwoFactorPending is called on login, users with two factor enabled
+// stay pending until VerifyTwoFactor succeeds.
+func (self *SessionGuard) markTwoFactorPending(sess session.ISession, user IUser) {
+	if u, ok := user.(ITwoFactorUser); ok && u.GetTwoFactorSecret() != "" {
+		sess.Set(self.twoFactorKey(), true)
+	} else {
+		sess.Delete(self.twoFactorKey())
+	}
+}
+
+// TwoFactorConfig defines the config for the two factor middleware.
+type TwoFactorConfig struct {
+	// Guard is the session guard to check. Default the default guard.
+	Guard string
+	// PathPrefix limits the middleware to the path and the paths below it,
+	// e.g. "/admin" matches "/admin/users" but not "/administrators".
+	PathPrefix string
+	// ChallengePath is where pending users are redirected to enter their code.
+	ChallengePath string
+}
+
+// TwoFactor returns a middleware that keeps users with a pending second
+// factor out of everything but the challenge page.
+func TwoFactor(config TwoFactorConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			var path = context.Request().URL.Path
+
+			if !hasPathPrefix(path, config.PathPrefix) || path == config.ChallengePath {
+				return next(context)
+			}
+
+			manager := Default(context)
+			name := config.Guard
+
+			if name == "" {
+				name = manager.defaultGuard
+			}
+
+			if !manager.HasGuard(name) || session.Default(context) == nil {
+				return next(context)
+			}
+
+			guard, ok := manager.Guard(name).(*SessionGuard)
+
+			if !ok || !guard.TwoFactorPending() {
+				return next(context)
+			}
+
+			if context.Request().Method == http.MethodGet && config.ChallengePath != "" {
+				return context.Redirect(http.StatusFound, config.ChallengePath)
+			}
+
+			return echo.NewHTTPError(http.StatusForbidden, "two factor authentication required")
+		}
+	}
+}
+
+// hasPathPrefix reports whether the path is the prefix or below it.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
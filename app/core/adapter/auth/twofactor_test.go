@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/adapter/session"
+	utilsCache "github.com/dulumao/Guten-utils/os/cache"
+	"github.com/labstack/echo"
+)
+
+type twoFactorUser struct {
+	*testUser
+	secret string
+}
+
+func (self *twoFactorUser) GetTwoFactorSecret() string {
+	return self.secret
+}
+
+func (self *twoFactorUser) GetRecoveryCodes() []string {
+	return nil
+}
+
+type twoFactorProvider struct {
+	*testProvider
+	user *twoFactorUser
+}
+
+func (self *twoFactorProvider) RetrieveById(id interface{}) (IUser, error) {
+	return self.user, nil
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 SHA-1 test vectors, truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	for unix, expected := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		code, err := TOTPCode(secret, time.Unix(unix, 0))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != expected {
+			t.Errorf("%d: expect %s, got %s", unix, expected, code)
+		}
+	}
+
+	previous, _ := TOTPCode(secret, time.Now().Add(-TOTPPeriod))
+
+	if !VerifyTOTP(secret, previous) {
+		t.Error("expect the previous code within the skew window")
+	}
+
+	expired, _ := TOTPCode(secret, time.Now().Add(-3*TOTPPeriod))
+
+	if VerifyTOTP(secret, expired) {
+		t.Error("expect codes outside the skew window to fail")
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	plain, hashed, err := GenerateRecoveryCodes(8)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining, ok := UseRecoveryCode(hashed, plain[3])
+
+	if !ok || len(remaining) != 7 {
+		t.Fatal("expect the code to be used")
+	}
+
+	if _, ok := UseRecoveryCode(remaining, plain[3]); ok {
+		t.Error("expect a recovery code to work only once")
+	}
+}
+
+func TestSessionGuard_TwoFactor(t *testing.T) {
+	adapter, _ := utilsCache.NewCache("memory", `{"interval":0}`)
+	cache.Store = cache.NewRepository(adapter, cache.JSON)
+	defer func() { cache.Store = nil }()
+
+	secret, _ := GenerateTOTPSecret()
+	user := &twoFactorUser{testUser: &testUser{id: 1}, secret: secret}
+	provider := &twoFactorProvider{testProvider: &testProvider{}, user: user}
+	app := newTestApp(session.NewMemoryStore([]byte("secret")), provider)
+
+	var cookie *http.Cookie
+	var err error
+
+	serve := func(path string, handler func(guard *SessionGuard) error) {
+		app.POST(path, func(c echo.Context) error {
+			err = handler(Default(c).Guard("web").(*SessionGuard))
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+	}
+
+	login := func() {
+		serve("/login", func(guard *SessionGuard) error {
+			return guard.Login(user)
+		})
+	}
+
+	verify := func(code string) error {
+		serve("/verify", func(guard *SessionGuard) error {
+			return guard.VerifyTwoFactor(code)
+		})
+
+		return err
+	}
+
+	login()
+
+	serve("/pending", func(guard *SessionGuard) error {
+		if guard.Check() || guard.User() != nil || guard.ID() != nil || guard.PendingUser() != user {
+			t.Error("expect the user to be pending, not logged in")
+		}
+
+		return nil
+	})
+
+	code, _ := TOTPCode(secret, time.Now())
+
+	if err := verify(code); err != nil {
+		t.Fatalf("expect the code to be accepted, got %v", err)
+	}
+
+	serve("/check", func(guard *SessionGuard) error {
+		if !guard.Check() || guard.PendingUser() != nil {
+			t.Error("expect the user to be logged in")
+		}
+
+		return nil
+	})
+
+	login()
+
+	if err := verify(code); err != ErrInvalidTwoFactorCode {
+		t.Errorf("expect a used code to be refused, got %v", err)
+	}
+
+	previous, _ := TOTPCode(secret, time.Now().Add(-TOTPPeriod))
+
+	if err := verify(previous); err != ErrInvalidTwoFactorCode {
+		t.Errorf("expect a code older than the used one to be refused, got %v", err)
+	}
+
+	for i := 2; i < MaxAttempts; i++ {
+		verify("000000")
+	}
+
+	if err := verify("000000"); err != ErrTooManyAttempts {
+		t.Errorf("expect ErrTooManyAttempts, got %v", err)
+	}
+
+	next, _ := TOTPCode(secret, time.Now().Add(TOTPPeriod))
+
+	if err := verify(next); err != ErrTooManyAttempts {
+		t.Errorf("expect a valid code to be locked out too, got %v", err)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	for path, expected := range map[string]bool{"/admin": true, "/admin/users": true, "/administrators": false, "/": false} {
+		if hasPathPrefix(path, "/admin/") != expected {
+			t.Errorf("%s: expect %v", path, expected)
+		}
+	}
+
+	if !hasPathPrefix("/users", "") {
+		t.Error("expect an empty prefix to match every path")
+	}
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/dulumao/Guten-utils/os/cache"
+	"github.com/gomodule/redigo/redis"
+)
+
+var ErrNotAtomic = errors.New("cache: the driver has no atomic operations")
+
+// IAtomic is implemented by drivers that count and add keys atomically
+// across instances. Repository falls back to a mutex of this process for
+// the others.
+type IAtomic interface {
+	// IncrBy adds by to the counter of the key and returns the new value. A
+	// new counter expires after ttl, 0 for never.
+	IncrBy(key string, by int64, ttl time.Duration) (int64, error)
+	// Add stores the value only if the key is missing and reports whether
+	// it did, ttl 0 for never.
+	Add(key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// memcacheMaxRelative is the largest expiration memcache takes as seconds
+// from now, larger values are unix times.
+const memcacheMaxRelative = 30 * 24 * time.Hour
+
+var redisIncrScript = redis.NewScript(1, `
+local exists = redis.call("EXISTS", KEYS[1])
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if exists == 0 and tonumber(ARGV[2]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value`)
+
+// redisCache adds key listing and atomic operations to the redis driver.
+type redisCache struct {
+	cache.Cache
+	*redisKeyLister
+}
+
+func (self *redisCache) IncrBy(key string, by int64, ttl time.Duration) (int64, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	var ms int64
+
+	if ttl > 0 {
+		ms = milliseconds(ttl)
+	}
+
+	return redis.Int64(redisIncrScript.Do(conn, self.namespace+":"+key, by, ms))
+}
+
+func (self *redisCache) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	var args = []interface{}{self.namespace + ":" + key, value, "NX"}
+
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+
+	reply, err := redis.String(conn.Do("SET", args...))
+
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	return reply == "OK", err
+}
+
+// memcacheCache puts the values of the memcache driver with expirations
+// memcache understands, and adds atomic operations.
+type memcacheCache struct {
+	cache.Cache
+	client *memcache.Client
+}
+
+func (self *memcacheCache) Put(key string, value interface{}, timeout time.Duration) error {
+	var item = &memcache.Item{Key: key, Expiration: memcacheExpiration(timeout)}
+
+	switch v := value.(type) {
+	case []byte:
+		item.Value = v
+	case string:
+		item.Value = []byte(v)
+	default:
+		return errors.New("cache: memcache only stores strings and []byte")
+	}
+
+	return self.client.Set(item)
+}
+
+// IncrBy counts with incr and decr, memcache counters do not go below 0.
+func (self *memcacheCache) IncrBy(key string, by int64, ttl time.Duration) (int64, error) {
+	for {
+		var value uint64
+		var err error
+
+		if by < 0 {
+			value, err = self.client.Decrement(key, uint64(-by))
+		} else {
+			value, err = self.client.Increment(key, uint64(by))
+		}
+
+		if err == nil {
+			return int64(value), nil
+		}
+
+		if err != memcache.ErrCacheMiss {
+			return 0, err
+		}
+
+		var initial int64
+
+		if by > 0 {
+			initial = by
+		}
+
+		// a counter added by another instance meanwhile is counted again
+		err = self.client.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatInt(initial, 10)), Expiration: memcacheExpiration(ttl)})
+
+		if err == nil {
+			return initial, nil
+		}
+
+		if err != memcache.ErrNotStored {
+			return 0, err
+		}
+	}
+}
+
+func (self *memcacheCache) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	err := self.client.Add(&memcache.Item{Key: key, Value: value, Expiration: memcacheExpiration(ttl)})
+
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// memcacheExpiration converts a ttl to the expiration of an item. Forever
+// and foreverTTL are 0, ttls over 30 days are sent as a unix time, which
+// memcache expects for them. Memcache expires in whole seconds, so ttls
+// are rounded up.
+func memcacheExpiration(ttl time.Duration) int32 {
+	if ttl <= 0 || ttl >= foreverTTL {
+		return 0
+	}
+
+	if ttl > memcacheMaxRelative {
+		return int32(time.Now().Add(ttl).Unix())
+	}
+
+	return int32((ttl + time.Second - 1) / time.Second)
+}
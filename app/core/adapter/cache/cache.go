@@ -1,37 +1,153 @@
 package cache
 
 import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/dulumao/Guten-framework/app/core/env"
 	"github.com/dulumao/Guten-utils/conv"
 	"github.com/dulumao/Guten-utils/os/cache"
+	_ "github.com/dulumao/Guten-utils/os/cache/memcache"
+	redisDriver "github.com/dulumao/Guten-utils/os/cache/redis"
+	"github.com/gomodule/redigo/redis"
 )
 
+// Cache is the raw adapter behind Store.
+//
+// Deprecated: use Store, it encodes values and supports context.Context.
 var Cache cache.Cache
 
+// Store is the typed cache of the application, nil until New succeeded.
+var Store *Repository
+
 func New() {
-	var cacheConfig = ``
+	var driver = env.Value.Cache.Driver
+
+	if driver == "tiered" {
+		driver = env.Value.Cache.Tiered.Remote
+	}
+
+	// the memory and file drivers keep the in-process locker
+	switch driver {
+	case "redis":
+		Locker = NewRedisLocker(redisPool())
+	case "memcache":
+		Locker = NewMemcacheLocker(memcacheClient())
+	}
+
+	adapter, err := cache.NewCache(driver, Config(driver))
+
+	if err != nil {
+		return
+	}
+
+	switch driver {
+	case "redis":
+		adapter = &redisCache{Cache: adapter, redisKeyLister: redisKeys()}
+	case "memcache":
+		adapter = &memcacheCache{Cache: adapter, client: memcacheClient()}
+	}
+
+	if env.Value.Cache.Driver == "tiered" {
+		if adapter, err = newTieredCache(adapter, driver); err != nil {
+			return
+		}
+	}
+
+	Cache = adapter
+	Store = NewRepository(adapter, JSON)
+}
+
+// newTieredCache puts the local layer in front of the remote driver. Only
+// redis broadcasts invalidations to other instances, with other remotes
+// keep env.cache.tiered.local_ttl short.
+func newTieredCache(remote cache.Cache, driver string) (cache.Cache, error) {
+	var config = env.Value.Cache.Tiered
+	var bus IPubSub = NewMemoryPubSub()
+	var size = 1000
+	var localTTL = 5 * time.Second
+	var channel = "cache:invalidate"
 
-	// memory
-	if env.Value.Cache.Driver == "memory" {
-		cacheConfig = `{"interval":` + conv.String(env.Value.Cache.Memory.Interval) + `}`
+	if driver == "redis" {
+		bus = NewRedisPubSub(redisPool())
 	}
 
-	// file
-	if env.Value.Cache.Driver == "file" {
-		cacheConfig = `{"CachePath":"` + env.Value.Cache.File.Path + `","FileSuffix":"` + env.Value.Cache.File.FileSuffix + `","DirectoryLevel":` + conv.String(env.Value.Cache.File.DirectoryLevel) + `,"EmbedExpiry":` + conv.String(env.Value.Cache.File.EmbedExpiry) + `}`
+	if config.Size > 0 {
+		size = config.Size
 	}
 
-	// redis
-	if env.Value.Cache.Driver == "redis" {
-		cacheConfig = `{"key":` + env.Value.Cache.Redis.Key + `,"conn":` + env.Value.Cache.Redis.Addr + `,"dbNum":"` + conv.String(env.Value.Cache.Redis.DbNumber) + `","password":` + env.Value.Cache.Redis.Password + `}`
+	if config.LocalTTL > 0 {
+		localTTL = time.Duration(config.LocalTTL) * time.Second
 	}
 
-	// memcache
-	if env.Value.Cache.Driver == "memcache" {
-		cacheConfig = `{"conn":` + env.Value.Cache.Memcache.Addr + `}`
+	if config.Channel != "" {
+		channel = config.Channel
 	}
 
-	if adapter, err := cache.NewCache(env.Value.Cache.Driver, cacheConfig); err == nil {
-		Cache = adapter
+	return NewTieredCache(remote, size, localTTL, bus, channel)
+}
+
+func redisPool() *redis.Pool {
+	return NewRedisPool(env.Value.Cache.Redis.Addr, env.Value.Cache.Redis.Password, env.Value.Cache.Redis.DbNumber)
+}
+
+func memcacheClient() *memcache.Client {
+	return memcache.New(strings.Split(env.Value.Cache.Memcache.Addr, ";")...)
+}
+
+func redisKeys() *redisKeyLister {
+	var namespace = env.Value.Cache.Redis.Key
+
+	if namespace == "" {
+		namespace = redisDriver.DefaultKey
+	}
+
+	return &redisKeyLister{pool: redisPool(), namespace: namespace}
+}
+
+// Config returns the JSON config of the driver built from env.Value.Cache.
+func Config(driver string) string {
+	var config interface{}
+
+	switch driver {
+	case "memory":
+		config = map[string]int{
+			"interval": env.Value.Cache.Memory.Interval,
+		}
+	case "file":
+		config = map[string]string{
+			"CachePath":      env.Value.Cache.File.Path,
+			"FileSuffix":     env.Value.Cache.File.FileSuffix,
+			"DirectoryLevel": conv.String(env.Value.Cache.File.DirectoryLevel),
+			"EmbedExpiry":    conv.String(env.Value.Cache.File.EmbedExpiry),
+		}
+	case "redis":
+		config = map[string]string{
+			"key":      env.Value.Cache.Redis.Key,
+			"conn":     env.Value.Cache.Redis.Addr,
+			"dbNum":    conv.String(env.Value.Cache.Redis.DbNumber),
+			"password": env.Value.Cache.Redis.Password,
+		}
+	case "memcache":
+		config = map[string]string{
+			"conn": env.Value.Cache.Memcache.Addr,
+		}
+	default:
+		return ""
 	}
+
+	// leave unset values out so the drivers fall back to their defaults
+	if values, ok := config.(map[string]string); ok {
+		for key, value := range values {
+			if value == "" {
+				delete(values, key)
+			}
+		}
+	}
+
+	b, _ := json.Marshal(config)
+
+	return string(b)
 }
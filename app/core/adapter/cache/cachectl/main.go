@@ -0,0 +1,29 @@
+// cachectl inspects the cache configured in env.toml.
+//
+//	cachectl stats [url]
+//	cachectl list [prefix]
+//	cachectl get <key>
+//	cachectl delete <key>...
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/env"
+)
+
+func main() {
+	if err := env.New(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cache.New()
+
+	if err := cache.RunCommand(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/env"
+	"github.com/gomodule/redigo/redis"
+)
+
+var ErrNotEnumerable = errors.New("cache: the driver can not list keys")
+
+// IEnumerable is implemented by drivers that can list their keys.
+type IEnumerable interface {
+	Keys(prefix string) ([]string, error)
+}
+
+// redisKeyLister lists the keys of the redis driver, which stores every key
+// as "<namespace>:<key>".
+type redisKeyLister struct {
+	pool      *redis.Pool
+	namespace string
+}
+
+func (self *redisKeyLister) Keys(prefix string) ([]string, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	var keys []string
+	var cursor = "0"
+	var namespace = self.namespace + ":"
+
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", namespace+prefix+"*", "COUNT", 1000))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cursor, err = redis.String(values[0], nil); err != nil {
+			return nil, err
+		}
+
+		found, err := redis.Strings(values[1], nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range found {
+			keys = append(keys, strings.TrimPrefix(key, namespace))
+		}
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Keys lists the keys with the prefix, ErrNotEnumerable if the driver can
+// not list keys.
+func (self *Repository) Keys(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if enumerable, ok := self.adapter.(IEnumerable); ok {
+		return enumerable.Keys(prefix)
+	}
+
+	return nil, ErrNotEnumerable
+}
+
+// RunCommand inspects Store from the command line:
+//
+//	stats [url]        print the counters of the running server, fetched
+//	                   from its metrics_path or the url
+//	list [prefix]      list the keys, redis only
+//	get <key>          print the stored value
+//	delete <key>...    delete keys
+func RunCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: stats [url] | list [prefix] | get <key> | delete <key>...")
+	}
+
+	// the counters of this process are always 0
+	if args[0] == "stats" {
+		var url string
+
+		if len(args) > 1 {
+			url = args[1]
+		} else if url = metricsURL(); url == "" {
+			return errors.New("cache: set metrics_path of the cache in env.toml or pass the url of the metrics")
+		}
+
+		return fetchMetrics(url, out)
+	}
+
+	if Store == nil {
+		return errors.New("cache: no cache configured")
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		var prefix string
+
+		if len(args) > 1 {
+			prefix = args[1]
+		}
+
+		keys, err := Store.Keys(ctx, prefix)
+
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			fmt.Fprintln(out, key)
+		}
+
+		return nil
+	case "get":
+		if len(args) < 2 {
+			return errors.New("usage: get <key>")
+		}
+
+		data, ok := toBytes(Store.adapter.Get(args[1]))
+
+		if !ok {
+			return ErrMiss
+		}
+
+		_, err := fmt.Fprintln(out, string(decodeEntry(data).payload))
+
+		return err
+	case "delete":
+		if len(args) < 2 {
+			return errors.New("usage: delete <key>...")
+		}
+
+		return Store.Forget(ctx, args[1:]...)
+	}
+
+	return fmt.Errorf("cache: unknown command %q", args[0])
+}
+
+// metricsURL returns the URL of the metrics of the server, built from the
+// url or else the addr of the server in env.toml, "" without metrics_path.
+func metricsURL() string {
+	if env.Value == nil || env.Value.Cache.MetricsPath == "" {
+		return ""
+	}
+
+	var base = env.Value.Server.URL
+
+	if base == "" {
+		var addr = env.Value.Server.Addr
+
+		if strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+
+		base = "http://" + addr
+	}
+
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(env.Value.Cache.MetricsPath, "/")
+}
+
+func fetchMetrics(url string, out io.Writer) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("cache: %s answered %s", url, res.Status)
+	}
+
+	_, err = io.Copy(out, res.Body)
+
+	return err
+}
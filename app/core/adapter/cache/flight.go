@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+var errFlightPanicked = errors.New("cache: remember callback panicked")
+
+type flightCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+// flightGroup runs one computation per key at a time, callers arriving
+// while it runs wait for and share its result.
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+func (self *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	self.mutex.Lock()
+
+	if self.calls == nil {
+		self.calls = make(map[string]*flightCall)
+	}
+
+	if call, ok := self.calls[key]; ok {
+		self.mutex.Unlock()
+		call.wg.Wait()
+
+		return call.data, call.err
+	}
+
+	call := &flightCall{err: errFlightPanicked}
+	call.wg.Add(1)
+	self.calls[key] = call
+	self.mutex.Unlock()
+
+	// release the waiters even if fn panics
+	defer func() {
+		self.mutex.Lock()
+		delete(self.calls, key)
+		self.mutex.Unlock()
+
+		call.wg.Done()
+	}()
+
+	call.data, call.err = fn()
+
+	return call.data, call.err
+}
+
+// running reports whether a computation of the key is in progress.
+func (self *flightGroup) running(key string) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	_, ok := self.calls[key]
+
+	return ok
+}
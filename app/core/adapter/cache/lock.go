@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLockNotOwned = errors.New("cache: lock is not owned")
+	ErrLockTimeout  = errors.New("cache: timed out waiting for the lock")
+)
+
+// LockRetryInterval is how often Block retries to acquire a lock.
+var LockRetryInterval = 100 * time.Millisecond
+
+// ILocker keeps locks in a backend. Only the owner token that acquired a
+// lock can release or extend it.
+type ILocker interface {
+	// Acquire takes the lock for ttl if it is free.
+	Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error)
+	// Release frees the lock if it is held by the owner.
+	Release(ctx context.Context, name string, owner string) (bool, error)
+	// Extend resets the ttl of the lock if it is held by the owner.
+	Extend(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error)
+}
+
+// Locker is the locker of the cache driver, set by New.
+var Locker ILocker = NewMemoryLocker()
+
+// Lock is a named lock across instances.
+//
+//	lock := cache.NewLock("checkout:42", 10*time.Second)
+//
+//	if err := lock.Block(ctx, 5*time.Second); err != nil {
+//		return err
+//	}
+//
+//	defer lock.Release(ctx)
+type Lock struct {
+	Name  string
+	Owner string
+	TTL   time.Duration
+
+	locker ILocker
+	mutex  sync.Mutex
+	stop   chan struct{}
+}
+
+// NewLock returns a lock of Locker with a random owner token.
+func NewLock(name string, ttl time.Duration) *Lock {
+	return NewLockWith(Locker, name, ttl)
+}
+
+// NewLockWith returns a lock of the locker with a random owner token.
+func NewLockWith(locker ILocker, name string, ttl time.Duration) *Lock {
+	var b = make([]byte, 16)
+	rand.Read(b)
+
+	return RestoreLock(locker, name, hex.EncodeToString(b), ttl)
+}
+
+// RestoreLock returns the lock of a known owner token, e.g. to release a
+// lock acquired by another process.
+func RestoreLock(locker ILocker, name string, owner string, ttl time.Duration) *Lock {
+	return &Lock{
+		Name:   name,
+		Owner:  owner,
+		TTL:    ttl,
+		locker: locker,
+	}
+}
+
+func lockKey(name string) string {
+	return "lock:" + name
+}
+
+// Acquire tries to take the lock once.
+func (self *Lock) Acquire(ctx context.Context) (bool, error) {
+	return self.locker.Acquire(ctx, lockKey(self.Name), self.Owner, self.TTL)
+}
+
+// Block waits up to timeout for the lock, ErrLockTimeout if it stays taken.
+func (self *Lock) Block(ctx context.Context, timeout time.Duration) error {
+	var deadline = time.Now().Add(timeout)
+
+	for {
+		ok, err := self.Acquire(ctx)
+
+		if err != nil || ok {
+			return err
+		}
+
+		if time.Now().Add(LockRetryInterval).After(deadline) {
+			return ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+// Extend resets the ttl of the held lock.
+func (self *Lock) Extend(ctx context.Context) error {
+	ok, err := self.locker.Extend(ctx, lockKey(self.Name), self.Owner, self.TTL)
+
+	if err == nil && !ok {
+		err = ErrLockNotOwned
+	}
+
+	return err
+}
+
+// AutoExtend extends the held lock every third of its ttl until Release,
+// for work that may outlast the ttl. Locks under 3 seconds are not
+// extended, memcache expires in whole seconds.
+func (self *Lock) AutoExtend() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.stop != nil || self.TTL < 3*time.Second {
+		return
+	}
+
+	var stop = make(chan struct{})
+	self.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(self.TTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if self.Extend(context.Background()) != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Release frees the lock, ErrLockNotOwned if it expired or was taken over.
+func (self *Lock) Release(ctx context.Context) error {
+	self.mutex.Lock()
+
+	if self.stop != nil {
+		close(self.stop)
+		self.stop = nil
+	}
+
+	self.mutex.Unlock()
+
+	ok, err := self.locker.Release(ctx, lockKey(self.Name), self.Owner)
+
+	if err == nil && !ok {
+		err = ErrLockNotOwned
+	}
+
+	return err
+}
+
+// WithLock runs fn while holding the lock, waiting up to timeout for it.
+func WithLock(ctx context.Context, name string, ttl time.Duration, timeout time.Duration, fn func() error) error {
+	lock := NewLock(name, ttl)
+
+	if err := lock.Block(ctx, timeout); err != nil {
+		return err
+	}
+
+	lock.AutoExtend()
+	defer lock.Release(ctx)
+
+	return fn()
+}
+
+type memoryLock struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// MemoryLocker keeps locks in this process, for the memory and file
+// drivers and for tests.
+type MemoryLocker struct {
+	mutex sync.Mutex
+	locks map[string]memoryLock
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]memoryLock)}
+}
+
+func (self *MemoryLocker) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if lock, ok := self.locks[name]; ok && time.Now().Before(lock.expiresAt) {
+		return false, nil
+	}
+
+	self.locks[name] = memoryLock{owner: owner, expiresAt: time.Now().Add(ttl)}
+
+	return true, nil
+}
+
+func (self *MemoryLocker) Release(ctx context.Context, name string, owner string) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if lock, ok := self.locks[name]; !ok || lock.owner != owner || time.Now().After(lock.expiresAt) {
+		return false, nil
+	}
+
+	delete(self.locks, name)
+
+	return true, nil
+}
+
+func (self *MemoryLocker) Extend(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if lock, ok := self.locks[name]; !ok || lock.owner != owner || time.Now().After(lock.expiresAt) {
+		return false, nil
+	}
+
+	self.locks[name] = memoryLock{owner: owner, expiresAt: time.Now().Add(ttl)}
+
+	return true, nil
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// MemcacheLocker keeps locks in memcache. Acquire uses add, which only
+// stores free keys, release and extend compare-and-swap the owner's item.
+// Memcache expires in whole seconds, so ttls are rounded up, and takes ttls
+// over 30 days as unix times.
+type MemcacheLocker struct {
+	client *memcache.Client
+}
+
+func NewMemcacheLocker(client *memcache.Client) *MemcacheLocker {
+	return &MemcacheLocker{client: client}
+}
+
+func (self *MemcacheLocker) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	err := self.client.Add(&memcache.Item{Key: name, Value: []byte(owner), Expiration: lockExpiration(ttl)})
+
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (self *MemcacheLocker) Release(ctx context.Context, name string, owner string) (bool, error) {
+	// an item with a negative expiration expires at once
+	return self.swap(name, owner, -1)
+}
+
+func (self *MemcacheLocker) Extend(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	return self.swap(name, owner, lockExpiration(ttl))
+}
+
+func (self *MemcacheLocker) swap(name string, owner string, expiration int32) (bool, error) {
+	item, err := self.client.Get(name)
+
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if string(item.Value) != owner {
+		return false, nil
+	}
+
+	item.Expiration = expiration
+	err = self.client.CompareAndSwap(item)
+
+	if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// lockExpiration is the memcache expiration of a lock, at least a second
+// so a lock never lives forever.
+func lockExpiration(ttl time.Duration) int32 {
+	if ttl < time.Second {
+		return 1
+	}
+
+	return memcacheExpiration(ttl)
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	redisReleaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	redisExtendScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// RedisLocker keeps locks in redis with SET NX PX, releasing and extending
+// through scripts that check the owner atomically.
+type RedisLocker struct {
+	pool *redis.Pool
+}
+
+func NewRedisLocker(pool *redis.Pool) *RedisLocker {
+	return &RedisLocker{pool: pool}
+}
+
+// NewRedisPool returns a connection pool for the redis server.
+func NewRedisPool(addr string, password string, db int) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 180 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialPassword(password), redis.DialDatabase(db))
+		},
+	}
+}
+
+func (self *RedisLocker) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	reply, err := redis.String(conn.Do("SET", name, owner, "NX", "PX", milliseconds(ttl)))
+
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	return reply == "OK", err
+}
+
+func (self *RedisLocker) Release(ctx context.Context, name string, owner string) (bool, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	n, err := redis.Int(redisReleaseScript.Do(conn, name, owner))
+
+	return n == 1, err
+}
+
+func (self *RedisLocker) Extend(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	n, err := redis.Int(redisExtendScript.Do(conn, name, owner, milliseconds(ttl)))
+
+	return n == 1, err
+}
+
+func milliseconds(ttl time.Duration) int64 {
+	if ms := int64(ttl / time.Millisecond); ms > 0 {
+		return ms
+	}
+
+	return 1
+}
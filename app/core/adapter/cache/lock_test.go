@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	first := NewLockWith(locker, "job", 3*time.Second)
+	second := NewLockWith(locker, "job", time.Second)
+
+	if ok, _ := first.Acquire(ctx); !ok {
+		t.Fatal("expect the free lock to be acquired")
+	}
+
+	if ok, _ := second.Acquire(ctx); ok {
+		t.Fatal("expect the held lock to be refused")
+	}
+
+	if err := second.Release(ctx); err != ErrLockNotOwned {
+		t.Errorf("expect only the owner to release, got %v", err)
+	}
+
+	var expiresAt = locker.locks[lockKey("job")].expiresAt
+
+	first.AutoExtend()
+	time.Sleep(1100 * time.Millisecond)
+
+	locker.mutex.Lock()
+	extended := locker.locks[lockKey("job")].expiresAt.After(expiresAt)
+	locker.mutex.Unlock()
+
+	if !extended {
+		t.Fatal("expect the lock to be extended after a third of its ttl")
+	}
+
+	// locks under 3 seconds are not extended
+	short := NewLockWith(locker, "short", time.Second)
+	short.AutoExtend()
+
+	if short.stop != nil {
+		t.Error("expect a short lock not to be extended")
+	}
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.Block(ctx, time.Second); err != nil {
+		t.Errorf("expect the released lock to be acquired, got %v", err)
+	}
+
+	if err := NewLockWith(locker, "job", time.Second).Block(ctx, 150*time.Millisecond); err != ErrLockTimeout {
+		t.Errorf("expect ErrLockTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruItem struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// LRU is a bounded in-process cache, the least recently used item is
+// evicted when it is full.
+type LRU struct {
+	// OnEvict is called with the key of every item evicted for room.
+	OnEvict func(key string)
+
+	mutex sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:  size,
+		list:  list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (self *LRU) Get(key string) (interface{}, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	element, ok := self.items[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	item := element.Value.(*lruItem)
+
+	if time.Now().After(item.expiresAt) {
+		self.remove(element)
+		return nil, false
+	}
+
+	self.list.MoveToFront(element)
+
+	return item.value, true
+}
+
+func (self *LRU) Put(key string, value interface{}, ttl time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var expiresAt = time.Now().Add(ttl)
+
+	if element, ok := self.items[key]; ok {
+		element.Value = &lruItem{key: key, value: value, expiresAt: expiresAt}
+		self.list.MoveToFront(element)
+		return
+	}
+
+	self.items[key] = self.list.PushFront(&lruItem{key: key, value: value, expiresAt: expiresAt})
+
+	for self.size > 0 && self.list.Len() > self.size {
+		oldest := self.list.Back()
+		self.remove(oldest)
+
+		if self.OnEvict != nil {
+			self.OnEvict(oldest.Value.(*lruItem).key)
+		}
+	}
+}
+
+func (self *LRU) Delete(key string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if element, ok := self.items[key]; ok {
+		self.remove(element)
+	}
+}
+
+func (self *LRU) Clear() {
+	self.mutex.Lock()
+	self.list.Init()
+	self.items = make(map[string]*list.Element)
+	self.mutex.Unlock()
+}
+
+func (self *LRU) Len() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.list.Len()
+}
+
+func (self *LRU) remove(element *list.Element) {
+	self.list.Remove(element)
+	delete(self.items, element.Value.(*lruItem).key)
+}
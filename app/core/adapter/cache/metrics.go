@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/echo"
+)
+
+// Counters are the operations on the keys of one prefix.
+type Counters struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Sets      int64 `json:"sets"`
+	Deletes   int64 `json:"deletes"`
+	Evictions int64 `json:"evictions"`
+}
+
+// CacheMetrics counts cache operations per key prefix, the part of the key
+// before the first ":", e.g. "response" for "response:<hash>".
+type CacheMetrics struct {
+	mutex    sync.RWMutex
+	prefixes map[string]*Counters
+}
+
+// Metrics counts the operations of every Repository and tiered local layer.
+var Metrics = NewCacheMetrics()
+
+func init() {
+	expvar.Publish("cache", expvar.Func(func() interface{} {
+		return Metrics.Snapshot()
+	}))
+}
+
+func NewCacheMetrics() *CacheMetrics {
+	return &CacheMetrics{prefixes: make(map[string]*Counters)}
+}
+
+// KeyPrefix returns the prefix the key is counted under.
+func KeyPrefix(key string) string {
+	if i := strings.Index(key, ":"); i > 0 {
+		return key[:i]
+	}
+
+	return "_"
+}
+
+func (self *CacheMetrics) counters(key string) *Counters {
+	var prefix = KeyPrefix(key)
+
+	self.mutex.RLock()
+	counters, ok := self.prefixes[prefix]
+	self.mutex.RUnlock()
+
+	if ok {
+		return counters
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if counters, ok = self.prefixes[prefix]; !ok {
+		counters = new(Counters)
+		self.prefixes[prefix] = counters
+	}
+
+	return counters
+}
+
+func (self *CacheMetrics) Hit(key string) {
+	atomic.AddInt64(&self.counters(key).Hits, 1)
+}
+
+func (self *CacheMetrics) Miss(key string) {
+	atomic.AddInt64(&self.counters(key).Misses, 1)
+}
+
+func (self *CacheMetrics) Set(key string) {
+	atomic.AddInt64(&self.counters(key).Sets, 1)
+}
+
+func (self *CacheMetrics) Delete(key string) {
+	atomic.AddInt64(&self.counters(key).Deletes, 1)
+}
+
+func (self *CacheMetrics) Evict(key string) {
+	atomic.AddInt64(&self.counters(key).Evictions, 1)
+}
+
+// Snapshot returns a copy of the counters by prefix.
+func (self *CacheMetrics) Snapshot() map[string]Counters {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var snapshot = make(map[string]Counters, len(self.prefixes))
+
+	for prefix, counters := range self.prefixes {
+		snapshot[prefix] = Counters{
+			Hits:      atomic.LoadInt64(&counters.Hits),
+			Misses:    atomic.LoadInt64(&counters.Misses),
+			Sets:      atomic.LoadInt64(&counters.Sets),
+			Deletes:   atomic.LoadInt64(&counters.Deletes),
+			Evictions: atomic.LoadInt64(&counters.Evictions),
+		}
+	}
+
+	return snapshot
+}
+
+// Reset clears all counters.
+func (self *CacheMetrics) Reset() {
+	self.mutex.Lock()
+	self.prefixes = make(map[string]*Counters)
+	self.mutex.Unlock()
+}
+
+// WritePrometheus writes the counters in the Prometheus text format.
+func (self *CacheMetrics) WritePrometheus(w io.Writer) error {
+	var snapshot = self.Snapshot()
+	var prefixes = make([]string, 0, len(snapshot))
+
+	for prefix := range snapshot {
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Strings(prefixes)
+
+	var metrics = []struct {
+		name  string
+		help  string
+		value func(c Counters) int64
+	}{
+		{"cache_hits_total", "Cache reads that found a value.", func(c Counters) int64 { return c.Hits }},
+		{"cache_misses_total", "Cache reads that found no value.", func(c Counters) int64 { return c.Misses }},
+		{"cache_sets_total", "Values written to the cache.", func(c Counters) int64 { return c.Sets }},
+		{"cache_deletes_total", "Values deleted from the cache.", func(c Counters) int64 { return c.Deletes }},
+		{"cache_evictions_total", "Values evicted from the local layer for room.", func(c Counters) int64 { return c.Evictions }},
+	}
+
+	for _, metric := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", metric.name, metric.help, metric.name); err != nil {
+			return err
+		}
+
+		for _, prefix := range prefixes {
+			if _, err := fmt.Fprintf(w, "%s{prefix=%q} %d\n", metric.name, prefix, metric.value(snapshot[prefix])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// MetricsHandler serves Metrics in the Prometheus text format, or as JSON
+// with ?format=json.
+//
+//	app.GET("/metrics/cache", cache.MetricsHandler)
+func MetricsHandler(context echo.Context) error {
+	if context.QueryParam("format") == "json" {
+		return context.JSON(http.StatusOK, Metrics.Snapshot())
+	}
+
+	context.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	context.Response().WriteHeader(http.StatusOK)
+
+	return Metrics.WritePrometheus(context.Response())
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	Metrics.Reset()
+	defer Metrics.Reset()
+
+	ctx := context.Background()
+	store := newTestRepository(t, JSON)
+
+	var name string
+
+	store.Get(ctx, "user:1", &name)
+	store.Set(ctx, "user:1", "gopher", Forever)
+	store.Get(ctx, "user:1", &name)
+	store.Forget(ctx, "user:1")
+	store.Get(ctx, "plain", &name)
+
+	if counters := Metrics.Snapshot()["user"]; counters != (Counters{Hits: 1, Misses: 1, Sets: 1, Deletes: 1}) {
+		t.Errorf("unexpected counters %+v", counters)
+	}
+
+	var out bytes.Buffer
+
+	if err := Metrics.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`cache_hits_total{prefix="user"} 1`,
+		`cache_misses_total{prefix="_"} 1`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expect %q in\n%s", line, out.String())
+		}
+	}
+
+	// cachectl stats prints the counters of the server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Metrics.WritePrometheus(w)
+	}))
+	defer server.Close()
+
+	var stats bytes.Buffer
+
+	if err := RunCommand([]string{"stats", server.URL}, &stats); err != nil || stats.String() != out.String() {
+		t.Errorf("stats: %v\n%s", err, stats.String())
+	}
+
+	if _, err := store.Keys(ctx, ""); err != ErrNotEnumerable {
+		t.Errorf("expect ErrNotEnumerable for the memory driver, got %v", err)
+	}
+}
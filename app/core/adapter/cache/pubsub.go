@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// IPubSub broadcasts messages between instances.
+type IPubSub interface {
+	Publish(channel string, message string) error
+	// Subscribe calls handler with every message of the channel until the
+	// returned function is called.
+	Subscribe(channel string, handler func(message string)) (func(), error)
+}
+
+// MemoryPubSub delivers messages within this process, for tests and
+// single instance setups.
+type MemoryPubSub struct {
+	mutex    sync.RWMutex
+	handlers map[string]map[int]func(message string)
+	next     int
+}
+
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{handlers: make(map[string]map[int]func(message string))}
+}
+
+func (self *MemoryPubSub) Publish(channel string, message string) error {
+	self.mutex.RLock()
+	var handlers = make([]func(message string), 0, len(self.handlers[channel]))
+
+	for _, handler := range self.handlers[channel] {
+		handlers = append(handlers, handler)
+	}
+
+	self.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+
+	return nil
+}
+
+func (self *MemoryPubSub) Subscribe(channel string, handler func(message string)) (func(), error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.handlers[channel] == nil {
+		self.handlers[channel] = make(map[int]func(message string))
+	}
+
+	var id = self.next
+	self.next++
+	self.handlers[channel][id] = handler
+
+	return func() {
+		self.mutex.Lock()
+		delete(self.handlers[channel], id)
+		self.mutex.Unlock()
+	}, nil
+}
+
+// RedisPubSub broadcasts messages through redis PUBLISH and SUBSCRIBE.
+// Subscriptions reconnect after connection errors.
+type RedisPubSub struct {
+	pool *redis.Pool
+}
+
+func NewRedisPubSub(pool *redis.Pool) *RedisPubSub {
+	return &RedisPubSub{pool: pool}
+}
+
+func (self *RedisPubSub) Publish(channel string, message string) error {
+	conn := self.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PUBLISH", channel, message)
+
+	return err
+}
+
+func (self *RedisPubSub) Subscribe(channel string, handler func(message string)) (func(), error) {
+	var mutex sync.Mutex
+	var closed bool
+	var current *redis.PubSubConn
+
+	connect := func() (*redis.PubSubConn, error) {
+		conn := &redis.PubSubConn{Conn: self.pool.Get()}
+
+		if err := conn.Subscribe(channel); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+
+	conn, err := connect()
+
+	if err != nil {
+		return nil, err
+	}
+
+	current = conn
+
+	go func() {
+		for {
+			switch v := conn.Receive().(type) {
+			case redis.Message:
+				handler(string(v.Data))
+			case error:
+				conn.Close()
+
+				for {
+					mutex.Lock()
+					stop := closed
+					mutex.Unlock()
+
+					if stop {
+						return
+					}
+
+					time.Sleep(time.Second)
+
+					if conn, err = connect(); err == nil {
+						mutex.Lock()
+						stop = closed
+						current = conn
+						mutex.Unlock()
+
+						if stop {
+							conn.Close()
+							return
+						}
+
+						break
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		mutex.Lock()
+		closed = true
+		current.Unsubscribe()
+		current.Close()
+		mutex.Unlock()
+	}, nil
+}
@@ -0,0 +1,446 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/dulumao/Guten-utils/os/cache"
+)
+
+// Forever is the ttl of values that do not expire.
+const Forever time.Duration = 0
+
+// foreverTTL is passed to the drivers for Forever, redis rejects a ttl of
+// 0. The memcache driver turns it back into 0.
+const foreverTTL = 10 * 365 * 24 * time.Hour
+
+var ErrMiss = errors.New("cache: miss")
+
+// ICodec turns values into the bytes stored by the driver.
+type ICodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	// JSON stores values as JSON, readable by other languages.
+	JSON ICodec = jsonCodec{}
+	// Gob stores values with encoding/gob, keeping Go types such as time.Time exactly.
+	Gob ICodec = gobCodec{}
+)
+
+// Repository is a typed cache on top of a driver. Values are encoded with
+// the codec and decoded into the pointer given to Get.
+type Repository struct {
+	// Beta tunes the early refresh of Remember, values above 1 refresh
+	// earlier, 0 disables it. Default 1.
+	Beta float64
+
+	adapter cache.Cache
+	codec   ICodec
+	mutex   sync.Mutex
+	flight  flightGroup
+}
+
+func NewRepository(adapter cache.Cache, codec ICodec) *Repository {
+	return &Repository{
+		Beta:    1,
+		adapter: adapter,
+		codec:   codec,
+	}
+}
+
+// Adapter returns the driver.
+func (self *Repository) Adapter() cache.Cache {
+	return self.adapter
+}
+
+// Get decodes the value of the key into v, ErrMiss if there is none.
+func (self *Repository) Get(ctx context.Context, key string, v interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, ok := toBytes(self.adapter.Get(key))
+
+	if !ok {
+		Metrics.Miss(key)
+		return ErrMiss
+	}
+
+	Metrics.Hit(key)
+
+	return self.codec.Unmarshal(decodeEntry(data).payload, v)
+}
+
+// Set stores the value for ttl, Forever if it should not expire.
+func (self *Repository) Set(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := self.codec.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	Metrics.Set(key)
+
+	return self.adapter.Put(key, encodeEntry(data, ttl, 0), driverTTL(ttl))
+}
+
+// Has reports whether the key is cached.
+func (self *Repository) Has(ctx context.Context, key string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	_, ok := toBytes(self.adapter.Get(key))
+
+	return ok
+}
+
+// Forget removes the keys.
+func (self *Repository) Forget(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		Metrics.Delete(key)
+
+		if err := self.adapter.Delete(key); err != nil && self.Has(ctx, key) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remember decodes the cached value of the key into v. On a miss fn
+// computes the value, which is cached for ttl and decoded into v.
+//
+// Concurrent misses of a key in this process share one call of fn. Shortly
+// before the value expires a caller may recompute it early, with a chance
+// growing as expiry nears and with the time fn took (XFetch), so a hot key
+// is refreshed by one caller instead of missed by all at once.
+//
+//	var user User
+//	err := cache.Store.Remember(ctx, "user:1", time.Hour, &user, func(ctx context.Context) (interface{}, error) {
+//		return loadUser(ctx, 1)
+//	})
+func (self *Repository) Remember(ctx context.Context, key string, ttl time.Duration, v interface{}, fn func(ctx context.Context) (interface{}, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	compute := func() ([]byte, error) {
+		var start = time.Now()
+
+		value, err := fn(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := self.codec.Marshal(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		Metrics.Set(key)
+
+		if err := self.adapter.Put(key, encodeEntry(data, ttl, time.Since(start)), driverTTL(ttl)); err != nil {
+			return nil, err
+		}
+
+		return data, nil
+	}
+
+	if cached, ok := toBytes(self.adapter.Get(key)); ok {
+		entry := decodeEntry(cached)
+
+		// serve the cached value while another caller refreshes it
+		if !entry.refreshEarly(self.Beta) || self.flight.running(key) {
+			Metrics.Hit(key)
+			return self.codec.Unmarshal(entry.payload, v)
+		}
+	} else {
+		Metrics.Miss(key)
+	}
+
+	data, err := self.flight.do(key, compute)
+
+	if err != nil {
+		return err
+	}
+
+	return self.codec.Unmarshal(data, v)
+}
+
+// Increment adds by to the counter of the key and returns the new value.
+// A missing counter starts at 0 and is kept for ttl. Redis and memcache
+// count atomically across instances, the other drivers within this process.
+func (self *Repository) Increment(ctx context.Context, key string, by int64, ttl time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	Metrics.Set(key)
+
+	if atomic, ok := self.adapter.(IAtomic); ok {
+		if value, err := atomic.IncrBy(key, by, ttl); err != ErrNotAtomic {
+			return value, err
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	value, _ := toInt64(self.adapter.Get(key))
+	value += by
+
+	return value, self.adapter.Put(key, []byte(strconv.FormatInt(value, 10)), driverTTL(ttl))
+}
+
+// Add stores the value only if the key is missing and reports whether it
+// did. Like Increment it is atomic across instances on redis and memcache.
+func (self *Repository) Add(ctx context.Context, key string, v interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	data, err := self.codec.Marshal(v)
+
+	if err != nil {
+		return false, err
+	}
+
+	data = encodeEntry(data, ttl, 0)
+
+	if atomic, ok := self.adapter.(IAtomic); ok {
+		if added, err := atomic.Add(key, data, ttl); err != ErrNotAtomic {
+			if added {
+				Metrics.Set(key)
+			}
+
+			return added, err
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := toBytes(self.adapter.Get(key)); ok {
+		return false, nil
+	}
+
+	Metrics.Set(key)
+
+	return true, self.adapter.Put(key, data, driverTTL(ttl))
+}
+
+// Decrement subtracts by from the counter of the key and returns the new value.
+func (self *Repository) Decrement(ctx context.Context, key string, by int64, ttl time.Duration) (int64, error) {
+	return self.Increment(ctx, key, -by, ttl)
+}
+
+// Counter returns the value of a counter set by Increment, 0 if there is none.
+func (self *Repository) Counter(ctx context.Context, key string) int64 {
+	if ctx.Err() != nil {
+		return 0
+	}
+
+	value, _ := toInt64(self.adapter.Get(key))
+
+	return value
+}
+
+// Many decodes the cached values of the keys into the pointers of dest and
+// returns the keys that missed.
+//
+//	var a, b Item
+//	missed, err := cache.Store.Many(ctx, map[string]interface{}{"a": &a, "b": &b})
+func (self *Repository) Many(ctx context.Context, dest map[string]interface{}) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys = make([]string, 0, len(dest))
+
+	for key := range dest {
+		keys = append(keys, key)
+	}
+
+	var values = self.adapter.GetMulti(keys)
+	var missed []string
+
+	for i, key := range keys {
+		var value interface{}
+
+		if i < len(values) {
+			value = values[i]
+		}
+
+		data, ok := toBytes(value)
+
+		if !ok {
+			Metrics.Miss(key)
+			missed = append(missed, key)
+			continue
+		}
+
+		Metrics.Hit(key)
+
+		if err := self.codec.Unmarshal(decodeEntry(data).payload, dest[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	return missed, nil
+}
+
+// SetMany stores all values for ttl.
+func (self *Repository) SetMany(ctx context.Context, values map[string]interface{}, ttl time.Duration) error {
+	for key, value := range values {
+		if err := self.Set(ctx, key, value, ttl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush removes every key.
+func (self *Repository) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return self.adapter.ClearAll()
+}
+
+// entryMagic starts entries written by Set and Remember, neither JSON nor
+// gob output starts with a zero byte.
+var entryMagic = []byte{0, 'g', 'c', 1}
+
+// entry is a cached value with the metadata of the early refresh.
+type entry struct {
+	payload   []byte
+	expiresAt int64 // unix nano, 0 for Forever
+	delta     int64 // nanoseconds the computation took
+}
+
+func encodeEntry(payload []byte, ttl time.Duration, delta time.Duration) []byte {
+	var expiresAt int64
+
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	var data = make([]byte, len(entryMagic)+16, len(entryMagic)+16+len(payload))
+	copy(data, entryMagic)
+	binary.BigEndian.PutUint64(data[len(entryMagic):], uint64(expiresAt))
+	binary.BigEndian.PutUint64(data[len(entryMagic)+8:], uint64(delta))
+
+	return append(data, payload...)
+}
+
+// decodeEntry also accepts plain values, e.g. counters written by Increment.
+func decodeEntry(data []byte) entry {
+	if len(data) < len(entryMagic)+16 || !bytes.Equal(data[:len(entryMagic)], entryMagic) {
+		return entry{payload: data}
+	}
+
+	return entry{
+		payload:   data[len(entryMagic)+16:],
+		expiresAt: int64(binary.BigEndian.Uint64(data[len(entryMagic):])),
+		delta:     int64(binary.BigEndian.Uint64(data[len(entryMagic)+8:])),
+	}
+}
+
+// refreshEarly decides whether to recompute the value before it expires:
+// now - delta * beta * ln(rand) >= expiry.
+func (self entry) refreshEarly(beta float64) bool {
+	if self.expiresAt == 0 || self.delta == 0 || beta <= 0 {
+		return false
+	}
+
+	gap := -float64(self.delta) * beta * math.Log(1-rand.Float64())
+
+	return float64(time.Now().UnixNano())+gap >= float64(self.expiresAt)
+}
+
+func driverTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return foreverTTL
+	}
+
+	return ttl
+}
+
+// toBytes normalizes what the drivers return for a key, the file driver
+// returns "" and the others nil for a miss.
+func toBytes(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case []byte:
+		return v, len(v) > 0
+	case string:
+		return []byte(v), v != ""
+	default:
+		return nil, false
+	}
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case nil:
+		return 0, false
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	default:
+		return conv.Int64(v), true
+	}
+}
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dulumao/Guten-utils/os/cache"
+)
+
+type testItem struct {
+	Name string
+	At   time.Time
+}
+
+func newTestRepository(t *testing.T, codec ICodec) *Repository {
+	adapter, err := cache.NewCache("memory", `{"interval":0}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewRepository(adapter, codec)
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+
+	for name, codec := range map[string]ICodec{"json": JSON, "gob": Gob} {
+		store := newTestRepository(t, codec)
+		item := testItem{Name: "a", At: time.Now().Round(time.Second)}
+
+		var got testItem
+
+		if err := store.Get(ctx, "item", &got); err != ErrMiss {
+			t.Errorf("%s: expect ErrMiss, got %v", name, err)
+		}
+
+		if err := store.Set(ctx, "item", item, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Get(ctx, "item", &got); err != nil || got.Name != item.Name || !got.At.Equal(item.At) {
+			t.Errorf("%s: expect %v, got %v (%v)", name, item, got, err)
+		}
+
+		var calls int
+		var remembered testItem
+
+		for i := 0; i < 2; i++ {
+			err := store.Remember(ctx, "remembered", time.Minute, &remembered, func(ctx context.Context) (interface{}, error) {
+				calls++
+				return item, nil
+			})
+
+			if err != nil || remembered.Name != "a" {
+				t.Errorf("%s: unexpected %v, %v", name, remembered, err)
+			}
+		}
+
+		if calls != 1 {
+			t.Errorf("%s: expect one call, got %d", name, calls)
+		}
+
+		var a, b testItem
+		missed, err := store.Many(ctx, map[string]interface{}{"item": &a, "none": &b})
+
+		if err != nil || len(missed) != 1 || missed[0] != "none" || a.Name != "a" {
+			t.Errorf("%s: unexpected Many result %v, %v", name, missed, err)
+		}
+
+		store.Forget(ctx, "item", "none")
+
+		if store.Has(ctx, "item") {
+			t.Errorf("%s: expect the item to be forgotten", name)
+		}
+	}
+}
+
+func TestRepository_Increment(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRepository(t, JSON)
+
+	for i := int64(1); i <= 3; i++ {
+		if n, err := store.Increment(ctx, "hits", 1, time.Minute); err != nil || n != i {
+			t.Fatalf("expect %d, got %d (%v)", i, n, err)
+		}
+	}
+
+	if n, _ := store.Decrement(ctx, "hits", 2, time.Minute); n != 1 || store.Counter(ctx, "hits") != 1 {
+		t.Errorf("expect 1, got %d", n)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := store.Set(cancelled, "hits", 5, time.Minute); err != context.Canceled {
+		t.Errorf("expect context.Canceled, got %v", err)
+	}
+}
+
+func TestRepository_Add(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRepository(t, JSON)
+
+	var added int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if ok, err := store.Add(ctx, "first", i, time.Minute); err != nil {
+				t.Error(err)
+			} else if ok {
+				atomic.AddInt32(&added, 1)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if added != 1 {
+		t.Errorf("expect one Add to store the key, got %d", added)
+	}
+}
+
+func TestMemcacheExpiration(t *testing.T) {
+	for _, test := range []struct {
+		ttl  time.Duration
+		want int32
+	}{
+		{Forever, 0},
+		{foreverTTL, 0},
+		{1500 * time.Millisecond, 2},
+		{memcacheMaxRelative, int32(memcacheMaxRelative / time.Second)},
+	} {
+		if got := memcacheExpiration(test.ttl); got != test.want {
+			t.Errorf("%v: expect %d, got %d", test.ttl, test.want, got)
+		}
+	}
+
+	// longer ttls are unix times
+	if got := memcacheExpiration(60 * 24 * time.Hour); int64(got) < time.Now().Unix() {
+		t.Errorf("expect a unix time, got %d", got)
+	}
+}
+
+func TestRepository_Tags(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRepository(t, JSON)
+
+	store.Tags("tenant:42", "posts").Set(ctx, "latest", "a", time.Minute)
+	store.Tags("tenant:7").Set(ctx, "latest", "b", time.Minute)
+
+	var value string
+
+	if err := store.Tags("posts", "tenant:42").Get(ctx, "latest", &value); err != nil || value != "a" {
+		t.Fatalf("expect a, got %q (%v)", value, err)
+	}
+
+	store.Tags("tenant:42").Flush(ctx)
+
+	if err := store.Tags("tenant:42", "posts").Get(ctx, "latest", &value); err != ErrMiss {
+		t.Errorf("expect the flushed tag to miss, got %v", err)
+	}
+
+	if err := store.Tags("tenant:7").Get(ctx, "latest", &value); err != nil || value != "b" {
+		t.Errorf("expect other tags to be kept, got %q (%v)", value, err)
+	}
+
+	// concurrent first calls agree on the version of a new tag
+	var versions = make([]string, 10)
+	var wg sync.WaitGroup
+
+	for i := range versions {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			versions[i], _ = store.Tags().version(ctx, "new")
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, version := range versions {
+		if version == "" || version != versions[0] {
+			t.Fatalf("expect one version, got %v", versions)
+		}
+	}
+}
+
+func TestRepository_RememberOnce(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRepository(t, JSON)
+	release := make(chan struct{})
+
+	var calls int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var value int
+
+			store.Remember(ctx, "hot", time.Minute, &value, func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 1, nil
+			})
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expect one call for concurrent misses, got %d", calls)
+	}
+}
+
+func TestEntry_RefreshEarly(t *testing.T) {
+	fresh := decodeEntry(encodeEntry([]byte("1"), time.Hour, time.Millisecond))
+	expiring := decodeEntry(encodeEntry([]byte("1"), time.Millisecond, time.Hour))
+
+	if fresh.refreshEarly(1) || !expiring.refreshEarly(1) {
+		t.Error("expect only values close to their expiry to be refreshed early")
+	}
+
+	if string(decodeEntry([]byte("5")).payload) != "5" {
+		t.Error("expect plain values to be read as they are")
+	}
+}
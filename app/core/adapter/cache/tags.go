@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaggedRepository caches values under a set of tags, flushing a tag drops
+// every value cached with it.
+//
+// Each tag has a version stored under "tag:<name>", the versions are part of
+// the keys of the tagged values. Flushing a tag gives it a new version, so
+// the old values are no longer found and expire on their own. This works
+// on every driver, none of them has to list or delete keys.
+//
+//	store := cache.Store.Tags("tenant:42", "posts")
+//	store.Set(ctx, "latest", posts, time.Hour)
+//	cache.Store.Tags("tenant:42").Flush(ctx)
+type TaggedRepository struct {
+	store *Repository
+	tags  []string
+}
+
+// Tags returns the repository of values tagged with all of the tags, in any order.
+func (self *Repository) Tags(tags ...string) *TaggedRepository {
+	var sorted = append([]string(nil), tags...)
+	sort.Strings(sorted)
+
+	return &TaggedRepository{store: self, tags: sorted}
+}
+
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
+// version returns the current version of the tag, creating one if needed.
+// A new version is added only if the tag has none, so concurrent first
+// calls agree on it.
+func (self *TaggedRepository) version(ctx context.Context, tag string) (string, error) {
+	var version string
+
+	err := self.store.Get(ctx, tagKey(tag), &version)
+
+	if err == nil && version != "" {
+		return version, nil
+	}
+
+	if err != nil && err != ErrMiss {
+		return "", err
+	}
+
+	version = newTagVersion()
+	added, err := self.store.Add(ctx, tagKey(tag), version, Forever)
+
+	if err != nil || added {
+		return version, err
+	}
+
+	// another caller added the version first
+	err = self.store.Get(ctx, tagKey(tag), &version)
+
+	return version, err
+}
+
+func (self *TaggedRepository) reset(ctx context.Context, tag string) (string, error) {
+	var version = newTagVersion()
+
+	return version, self.store.Set(ctx, tagKey(tag), version, Forever)
+}
+
+func newTagVersion() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// key returns the key of the value under the current tag versions.
+func (self *TaggedRepository) key(ctx context.Context, key string) (string, error) {
+	var versions = make([]string, 0, len(self.tags))
+
+	for _, tag := range self.tags {
+		version, err := self.version(ctx, tag)
+
+		if err != nil {
+			return "", err
+		}
+
+		versions = append(versions, tag+"="+version)
+	}
+
+	sum := sha1.Sum([]byte(strings.Join(versions, "|")))
+
+	return "tagged:" + hex.EncodeToString(sum[:]) + ":" + key, nil
+}
+
+func (self *TaggedRepository) Get(ctx context.Context, key string, v interface{}) error {
+	key, err := self.key(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	return self.store.Get(ctx, key, v)
+}
+
+func (self *TaggedRepository) Set(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	key, err := self.key(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	return self.store.Set(ctx, key, v, ttl)
+}
+
+func (self *TaggedRepository) Has(ctx context.Context, key string) bool {
+	key, err := self.key(ctx, key)
+
+	return err == nil && self.store.Has(ctx, key)
+}
+
+func (self *TaggedRepository) Remember(ctx context.Context, key string, ttl time.Duration, v interface{}, fn func(ctx context.Context) (interface{}, error)) error {
+	key, err := self.key(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	return self.store.Remember(ctx, key, ttl, v, fn)
+}
+
+func (self *TaggedRepository) Forget(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		key, err := self.key(ctx, key)
+
+		if err != nil {
+			return err
+		}
+
+		if err := self.store.Forget(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush drops every value cached with any of the tags.
+func (self *TaggedRepository) Flush(ctx context.Context) error {
+	for _, tag := range self.tags {
+		if _, err := self.reset(ctx, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TagVersions returns the current version of each tag. Values stored with
+// the versions are stale once any of them changed.
+func (self *Repository) TagVersions(ctx context.Context, tags ...string) (map[string]string, error) {
+	var versions = make(map[string]string, len(tags))
+	var tagged = self.Tags()
+
+	for _, tag := range tags {
+		version, err := tagged.version(ctx, tag)
+
+		if err != nil {
+			return nil, err
+		}
+
+		versions[tag] = version
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/dulumao/Guten-utils/os/cache"
+)
+
+// flushAll is the invalidation message of ClearAll.
+const flushAll = "*"
+
+// TieredCache is a driver with a bounded LRU in this process in front of a
+// remote driver. Values read from the remote are kept locally for at most
+// LocalTTL. Writes go to the remote and are broadcast on the pub/sub
+// channel, so every instance drops its local copy.
+type TieredCache struct {
+	// LocalTTL is the longest time a value is served from the local layer.
+	LocalTTL time.Duration
+
+	local       *LRU
+	remote      cache.Cache
+	bus         IPubSub
+	channel     string
+	id          string
+	unsubscribe func()
+}
+
+// NewTieredCache returns a tiered driver keeping up to size values locally,
+// subscribed to the invalidations of the channel.
+func NewTieredCache(remote cache.Cache, size int, localTTL time.Duration, bus IPubSub, channel string) (*TieredCache, error) {
+	var b = make([]byte, 8)
+	rand.Read(b)
+
+	local := NewLRU(size)
+	local.OnEvict = Metrics.Evict
+
+	self := &TieredCache{
+		LocalTTL: localTTL,
+		local:    local,
+		remote:   remote,
+		bus:      bus,
+		channel:  channel,
+		id:       hex.EncodeToString(b),
+	}
+
+	unsubscribe, err := bus.Subscribe(channel, self.invalidated)
+
+	if err != nil {
+		return nil, err
+	}
+
+	self.unsubscribe = unsubscribe
+
+	return self, nil
+}
+
+// Local returns the local layer.
+func (self *TieredCache) Local() *LRU {
+	return self.local
+}
+
+// Remote returns the remote driver.
+func (self *TieredCache) Remote() cache.Cache {
+	return self.remote
+}
+
+// Close stops listening for invalidations.
+func (self *TieredCache) Close() {
+	self.unsubscribe()
+}
+
+// invalidated handles "<instance id>:<key>" messages of the other instances.
+func (self *TieredCache) invalidated(message string) {
+	var parts = strings.SplitN(message, ":", 2)
+
+	if len(parts) != 2 || parts[0] == self.id {
+		return
+	}
+
+	if parts[1] == flushAll {
+		self.local.Clear()
+	} else {
+		self.local.Delete(parts[1])
+	}
+}
+
+func (self *TieredCache) invalidate(key string) {
+	if key == flushAll {
+		self.local.Clear()
+	} else {
+		self.local.Delete(key)
+	}
+
+	self.bus.Publish(self.channel, self.id+":"+key)
+}
+
+func (self *TieredCache) Get(key string) interface{} {
+	if value, ok := self.local.Get(key); ok {
+		return value
+	}
+
+	value := self.remote.Get(key)
+
+	if data, ok := toBytes(value); ok {
+		var ttl = self.LocalTTL
+
+		// never serve a value locally after it expired remotely
+		if expiresAt := decodeEntry(data).expiresAt; expiresAt > 0 {
+			if remaining := time.Until(time.Unix(0, expiresAt)); remaining < ttl {
+				ttl = remaining
+			}
+		}
+
+		if ttl > 0 {
+			self.local.Put(key, value, ttl)
+		}
+	}
+
+	return value
+}
+
+func (self *TieredCache) GetMulti(keys []string) []interface{} {
+	var values = make([]interface{}, 0, len(keys))
+
+	for _, key := range keys {
+		values = append(values, self.Get(key))
+	}
+
+	return values
+}
+
+func (self *TieredCache) Put(key string, value interface{}, timeout time.Duration) error {
+	if err := self.remote.Put(key, value, timeout); err != nil {
+		return err
+	}
+
+	self.invalidate(key)
+
+	return nil
+}
+
+func (self *TieredCache) Delete(key string) error {
+	err := self.remote.Delete(key)
+	self.invalidate(key)
+
+	return err
+}
+
+func (self *TieredCache) Incr(key string) error {
+	err := self.remote.Incr(key)
+	self.invalidate(key)
+
+	return err
+}
+
+func (self *TieredCache) Decr(key string) error {
+	err := self.remote.Decr(key)
+	self.invalidate(key)
+
+	return err
+}
+
+func (self *TieredCache) IsExist(key string) bool {
+	if _, ok := self.local.Get(key); ok {
+		return true
+	}
+
+	return self.remote.IsExist(key)
+}
+
+func (self *TieredCache) ClearAll() error {
+	err := self.remote.ClearAll()
+	self.invalidate(flushAll)
+
+	return err
+}
+
+// Keys lists the keys of the remote driver, if it can enumerate.
+func (self *TieredCache) Keys(prefix string) ([]string, error) {
+	if enumerable, ok := self.remote.(IEnumerable); ok {
+		return enumerable.Keys(prefix)
+	}
+
+	return nil, ErrNotEnumerable
+}
+
+// IncrBy counts in the remote driver, ErrNotAtomic if it can not.
+func (self *TieredCache) IncrBy(key string, by int64, ttl time.Duration) (int64, error) {
+	atomic, ok := self.remote.(IAtomic)
+
+	if !ok {
+		return 0, ErrNotAtomic
+	}
+
+	value, err := atomic.IncrBy(key, by, ttl)
+	self.invalidate(key)
+
+	return value, err
+}
+
+// Add adds the key to the remote driver, ErrNotAtomic if it can not.
+func (self *TieredCache) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	atomic, ok := self.remote.(IAtomic)
+
+	if !ok {
+		return false, ErrNotAtomic
+	}
+
+	added, err := atomic.Add(key, value, ttl)
+
+	if added {
+		self.invalidate(key)
+	}
+
+	return added, err
+}
+
+// StartAndGC is a no-op, tiered drivers are built with NewTieredCache.
+func (self *TieredCache) StartAndGC(config string) error {
+	return nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dulumao/Guten-utils/os/cache"
+)
+
+func TestLRU(t *testing.T) {
+	var evicted []string
+
+	lru := NewLRU(2)
+	lru.OnEvict = func(key string) {
+		evicted = append(evicted, key)
+	}
+
+	lru.Put("a", 1, time.Minute)
+	lru.Put("b", 2, time.Minute)
+	lru.Get("a")
+	lru.Put("c", 3, time.Minute)
+
+	if _, ok := lru.Get("b"); ok || len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("expect the least recently used item to be evicted, got %v", evicted)
+	}
+
+	lru.Put("d", 4, -time.Second)
+
+	if _, ok := lru.Get("d"); ok {
+		t.Error("expect expired items to miss")
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+	remote, _ := cache.NewCache("memory", `{"interval":0}`)
+	bus := NewMemoryPubSub()
+
+	first, _ := NewTieredCache(remote, 10, time.Minute, bus, "invalidate")
+	second, _ := NewTieredCache(remote, 10, time.Minute, bus, "invalidate")
+	defer first.Close()
+	defer second.Close()
+
+	a := NewRepository(first, JSON)
+	b := NewRepository(second, JSON)
+
+	a.Set(ctx, "page", "v1", time.Minute)
+
+	var value string
+
+	if err := b.Get(ctx, "page", &value); err != nil || value != "v1" {
+		t.Fatalf("expect v1, got %q (%v)", value, err)
+	}
+
+	if second.Local().Len() != 1 {
+		t.Fatal("expect the value to be kept locally")
+	}
+
+	a.Set(ctx, "page", "v2", time.Minute)
+
+	if err := b.Get(ctx, "page", &value); err != nil || value != "v2" {
+		t.Errorf("expect the local copy to be invalidated, got %q (%v)", value, err)
+	}
+
+	a.Flush(ctx)
+
+	if second.Local().Len() != 0 {
+		t.Error("expect a flush to clear the local layers")
+	}
+}
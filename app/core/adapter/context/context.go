@@ -7,7 +7,6 @@ import (
 	"github.com/dulumao/Guten-utils/conv"
 	"github.com/gookit/validate"
 	"github.com/labstack/echo"
-	"strings"
 	"time"
 )
 
@@ -20,8 +19,10 @@ func (self *Context) GetSession() session.ISession {
 	return session.Default(self.Context)
 }
 
+// GetAuth returns the auth manager of the request. Resolved users are cached
+// on it, so repeated calls do not hit the user provider again.
 func (self *Context) GetAuth() *auth.AuthManager {
-	return auth.New().SetContext(self.Context)
+	return auth.Default(self.Context)
 }
 
 func (self *Context) SetCodeCompiledTimeAt() {
@@ -107,7 +108,7 @@ func (self *Context) IsPut() bool {
 }
 
 func (self *Context) IsAjax() bool {
-	return strings.ToLower(self.Request().Header.Get("X-Requested-With")) == "xmlhttprequest"
+	return IsAjax(self.Context)
 }
 
 func (self *Context) ValidateStruct(i interface{}) (*validate.Validation) {
@@ -0,0 +1,373 @@
+package context
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/labstack/echo"
+	"github.com/vmihailenco/msgpack"
+)
+
+const (
+	MIMEApplicationMsgpack = "application/msgpack"
+	MIMETextCSV            = "text/csv"
+)
+
+var ErrNotAcceptable = echo.NewHTTPError(http.StatusNotAcceptable)
+
+// ErrUnsupportedData is returned by serializers that can not encode the data.
+var ErrUnsupportedData = errors.New("context: the data can not be serialized in this format")
+
+// ErrorData is the data of the error responses, the keys are the elements
+// of an <error> element in XML, which can not encode plain maps.
+type ErrorData map[string]interface{}
+
+func (self ErrorData) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	var keys = make([]string, 0, len(self))
+
+	for key := range self {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	start = xml.StartElement{Name: xml.Name{Local: "error"}}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := e.EncodeElement(self[key], xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// Serializer writes the data as the response in one format.
+type Serializer func(c echo.Context, status int, data interface{}) error
+
+type serializer struct {
+	mime      string
+	serialize Serializer
+}
+
+var serializers = struct {
+	sync.RWMutex
+	list []serializer
+}{
+	list: []serializer{
+		{echo.MIMEApplicationJSON, func(c echo.Context, status int, data interface{}) error {
+			return c.JSON(status, data)
+		}},
+		{echo.MIMEApplicationXML, func(c echo.Context, status int, data interface{}) error {
+			// marshalled first, c.XML fails after the header was written
+			b, err := xml.Marshal(data)
+
+			if err != nil {
+				return err
+			}
+
+			return c.XMLBlob(status, b)
+		}},
+		{MIMEApplicationMsgpack, func(c echo.Context, status int, data interface{}) error {
+			b, err := msgpack.Marshal(data)
+
+			if err != nil {
+				return err
+			}
+
+			return c.Blob(status, MIMEApplicationMsgpack, b)
+		}},
+		{MIMETextCSV, func(c echo.Context, status int, data interface{}) error {
+			b, err := marshalCSV(data)
+
+			if err != nil {
+				return err
+			}
+
+			return c.Blob(status, MIMETextCSV+"; charset=utf-8", b)
+		}},
+	},
+}
+
+// RegisterSerializer adds or replaces the serializer of a media type, e.g.
+// "application/x-yaml". HTML is always rendered with the view.
+func RegisterSerializer(mime string, fn Serializer) {
+	serializers.Lock()
+	defer serializers.Unlock()
+
+	for i, s := range serializers.list {
+		if s.mime == mime {
+			serializers.list[i].serialize = fn
+			return
+		}
+	}
+
+	serializers.list = append(serializers.list, serializer{mime: mime, serialize: fn})
+}
+
+// Respond writes the data in the format the client accepts best: the view
+// rendered with the data for HTML, or one of the serializers. Without a view
+// HTML is not offered, ajax requests accepting anything get JSON.
+func Respond(c echo.Context, status int, view string, data interface{}) error {
+	serializers.RLock()
+	var list = serializers.list
+	serializers.RUnlock()
+
+	var offers = make([]string, 0, len(list)+1)
+
+	if view != "" && !IsAjax(c) {
+		offers = append(offers, echo.MIMETextHTML)
+	}
+
+	for _, s := range list {
+		offers = append(offers, s.mime)
+	}
+
+	if view != "" && IsAjax(c) {
+		offers = append(offers, echo.MIMETextHTML)
+	}
+
+	mime := Negotiate(c.Request().Header.Get(echo.HeaderAccept), offers...)
+
+	if mime == "" {
+		return ErrNotAcceptable
+	}
+
+	if c.Request().Method == echo.HEAD {
+		c.Response().Header().Set(echo.HeaderContentType, mime)
+		return c.NoContent(status)
+	}
+
+	if mime == echo.MIMETextHTML {
+		return c.Render(status, view, data)
+	}
+
+	for _, s := range list {
+		if s.mime == mime {
+			return s.serialize(c, status, data)
+		}
+	}
+
+	return ErrNotAcceptable
+}
+
+// Respond writes the data in the format the client accepts best, see the
+// Respond function.
+func (self *Context) Respond(status int, view string, data interface{}) error {
+	return Respond(self.Context, status, view, data)
+}
+
+// IsAjax reports whether the request was sent by XMLHttpRequest, the header
+// is compared case insensitively.
+func IsAjax(c echo.Context) bool {
+	return strings.ToLower(c.Request().Header.Get("X-Requested-With")) == "xmlhttprequest"
+}
+
+type accept struct {
+	mime  string
+	q     float64
+	index int
+}
+
+// Negotiate returns the offer the Accept header prefers, the first offer for
+// an empty header and "" if none is acceptable. Exact types are preferred
+// over "type/*" and "*/*" with the same quality.
+func Negotiate(header string, offers ...string) string {
+	if strings.TrimSpace(header) == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+
+		return ""
+	}
+
+	var accepts []accept
+
+	for i, part := range strings.Split(header, ",") {
+		var fields = strings.Split(part, ";")
+		var a = accept{mime: strings.ToLower(strings.TrimSpace(fields[0])), q: 1, index: i}
+
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					a.q = q
+				}
+			}
+		}
+
+		if a.mime != "" && a.q > 0 {
+			accepts = append(accepts, a)
+		}
+	}
+
+	// by quality, then specificity, then order
+	sort.SliceStable(accepts, func(i, j int) bool {
+		if accepts[i].q != accepts[j].q {
+			return accepts[i].q > accepts[j].q
+		}
+
+		return specificity(accepts[i].mime) > specificity(accepts[j].mime)
+	})
+
+	for _, a := range accepts {
+		for _, offer := range offers {
+			if matchMIME(a.mime, offer) {
+				return offer
+			}
+		}
+	}
+
+	return ""
+}
+
+func specificity(mime string) int {
+	switch {
+	case mime == "*/*":
+		return 0
+	case strings.HasSuffix(mime, "/*"):
+		return 1
+	}
+
+	return 2
+}
+
+func matchMIME(pattern, mime string) bool {
+	switch {
+	case pattern == "*/*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(mime, strings.TrimSuffix(pattern, "*"))
+	}
+
+	// application/x-msgpack is the common alias
+	if pattern == "application/x-msgpack" {
+		pattern = MIMEApplicationMsgpack
+	}
+
+	return pattern == mime
+}
+
+// marshalCSV encodes [][]string, a slice of maps or a slice of structs of
+// one type with a header row. Struct columns are named by the csv tag or the
+// field name, map columns are the keys of the first map. Nil rows are not
+// supported.
+func marshalCSV(data interface{}) ([]byte, error) {
+	var rows [][]string
+
+	if records, ok := data.([][]string); ok {
+		rows = records
+	} else {
+		v := reflect.Indirect(reflect.ValueOf(data))
+
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, ErrUnsupportedData
+		}
+
+		var header []string
+		var fields []int
+		var rowType reflect.Type
+
+		for i := 0; i < v.Len(); i++ {
+			item := reflect.Indirect(v.Index(i))
+
+			for item.Kind() == reflect.Interface {
+				item = reflect.Indirect(item.Elem())
+			}
+
+			// nil pointers and interfaces have no columns
+			if !item.IsValid() {
+				return nil, ErrUnsupportedData
+			}
+
+			// the columns are those of the first row
+			if rowType == nil {
+				rowType = item.Type()
+			} else if item.Kind() != rowType.Kind() || (item.Kind() == reflect.Struct && item.Type() != rowType) {
+				return nil, ErrUnsupportedData
+			}
+
+			switch item.Kind() {
+			case reflect.Map:
+				// keys of any type are indexed with their own values
+				var values = make(map[string]string, item.Len())
+
+				for _, key := range item.MapKeys() {
+					values[fmt.Sprint(key.Interface())] = conv.String(item.MapIndex(key).Interface())
+				}
+
+				if header == nil {
+					for name := range values {
+						header = append(header, name)
+					}
+
+					sort.Strings(header)
+					rows = append(rows, header)
+				}
+
+				var row = make([]string, len(header))
+
+				for j, name := range header {
+					row[j] = values[name]
+				}
+
+				rows = append(rows, row)
+			case reflect.Struct:
+				if header == nil {
+					for j := 0; j < item.NumField(); j++ {
+						field := item.Type().Field(j)
+
+						if field.PkgPath != "" || field.Tag.Get("csv") == "-" {
+							continue
+						}
+
+						name := field.Name
+
+						if tag := field.Tag.Get("csv"); tag != "" {
+							name = tag
+						}
+
+						header = append(header, name)
+						fields = append(fields, j)
+					}
+
+					rows = append(rows, header)
+				}
+
+				var row = make([]string, len(fields))
+
+				for j, field := range fields {
+					row[j] = conv.String(item.Field(field).Interface())
+				}
+
+				rows = append(rows, row)
+			default:
+				return nil, ErrUnsupportedData
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	var w = csv.NewWriter(&buf)
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,136 @@
+package context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestNegotiate(t *testing.T) {
+	var offers = []string{echo.MIMETextHTML, echo.MIMEApplicationJSON, MIMEApplicationMsgpack, MIMETextCSV}
+
+	for header, expected := range map[string]string{
+		"":                                     echo.MIMETextHTML,
+		"*/*":                                  echo.MIMETextHTML,
+		"application/json":                     echo.MIMEApplicationJSON,
+		"text/*;q=0.5, application/json;q=0.9": echo.MIMEApplicationJSON,
+		"text/csv, */*;q=0.1":                  MIMETextCSV,
+		"application/x-msgpack":                MIMEApplicationMsgpack,
+		"*/*;q=0.8, application/json":          echo.MIMEApplicationJSON,
+		"text/html;q=0, application/*":         echo.MIMEApplicationJSON,
+		"image/png":                            "",
+	} {
+		if mime := Negotiate(header, offers...); mime != expected {
+			t.Errorf("Negotiate(%q) = %q, expected %q", header, mime, expected)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	var e = echo.New()
+	var data = []map[string]interface{}{{"id": 1, "name": "a,b"}}
+
+	for _, test := range []struct {
+		accept, ajax string
+		code         int
+		contentType  string
+		body         string
+	}{
+		{"application/json", "", http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, `[{"id":1,"name":"a,b"}]`},
+		{"text/csv", "", http.StatusOK, MIMETextCSV + "; charset=utf-8", "id,name\n1,\"a,b\"\n"},
+		{"*/*", "XMLHttpRequest", http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, `[{"id":1,"name":"a,b"}]`},
+		{"image/png", "", http.StatusNotAcceptable, "", ""},
+	} {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		req.Header.Set(echo.HeaderAccept, test.accept)
+		req.Header.Set("X-Requested-With", test.ajax)
+		rec := httptest.NewRecorder()
+
+		if err := Respond(e.NewContext(req, rec), http.StatusOK, "", data); err != nil {
+			if he, ok := err.(*echo.HTTPError); !ok || he.Code != test.code {
+				t.Errorf("Accept %q: %v", test.accept, err)
+			}
+
+			continue
+		}
+
+		if rec.Code != test.code || rec.Header().Get(echo.HeaderContentType) != test.contentType {
+			t.Errorf("Accept %q: %d %q", test.accept, rec.Code, rec.Header().Get(echo.HeaderContentType))
+		}
+
+		if body := rec.Body.String(); body != test.body && body != test.body+"\n" {
+			t.Errorf("Accept %q: body %q, expected %q", test.accept, body, test.body)
+		}
+	}
+}
+
+func TestRespond_XML(t *testing.T) {
+	var e = echo.New()
+
+	for _, test := range []struct {
+		data     interface{}
+		expected string
+	}{
+		// plain maps fail before the response is written
+		{map[string]interface{}{"message": "failed"}, ""},
+		{ErrorData{"message": "failed"}, `<error><message>failed</message></error>`},
+	} {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationXML)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		err := Respond(c, http.StatusBadRequest, "", test.data)
+
+		if test.expected == "" {
+			if err == nil || c.Response().Committed {
+				t.Errorf("%T: error %v, committed %v", test.data, err, c.Response().Committed)
+			}
+
+			continue
+		}
+
+		if err != nil || rec.Code != http.StatusBadRequest || !strings.HasSuffix(rec.Body.String(), test.expected) {
+			t.Errorf("%T: %v %d %q", test.data, err, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestMarshalCSV(t *testing.T) {
+	type user struct {
+		ID   int `csv:"id"`
+		Name string
+	}
+
+	type other struct {
+		ID int `csv:"id"`
+	}
+
+	b, err := marshalCSV([]map[int]string{{2: "b", 1: "a"}, {1: "c"}})
+
+	if err != nil || string(b) != "1,2\na,b\nc,\n" {
+		t.Errorf("map[int]string: %q, %v", b, err)
+	}
+
+	if b, err = marshalCSV([]interface{}{user{1, "a"}, user{2, "b"}}); err != nil || string(b) != "id,Name\n1,a\n2,b\n" {
+		t.Errorf("structs: %q, %v", b, err)
+	}
+
+	if _, err = marshalCSV([]interface{}{user{1, "a"}, other{2}}); err != ErrUnsupportedData {
+		t.Errorf("structs of different types: %v", err)
+	}
+
+	if _, err = marshalCSV([]interface{}{map[string]int{"id": 1}, user{2, "b"}}); err != ErrUnsupportedData {
+		t.Errorf("a struct after a map: %v", err)
+	}
+
+	if _, err = marshalCSV([]*user{nil, {2, "b"}}); err != ErrUnsupportedData {
+		t.Errorf("a nil row: %v", err)
+	}
+
+	if _, err = marshalCSV([]interface{}{user{1, "a"}, nil}); err != ErrUnsupportedData {
+		t.Errorf("a nil interface row: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package gate authorizes what an authenticated user may do.
+//
+// An ability is checked in this order: Before callbacks, abilities defined
+// with Define, the policy of the model passed as first argument, and at last
+// the permissions the user has through its roles.
+package gate
+
+import (
+	"sync"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/labstack/echo"
+)
+
+const DefaultKey = "GATE"
+
+// Ability decides whether the user may do something.
+type Ability func(user auth.IUser, args ...interface{}) bool
+
+// BeforeCallback runs before every check. If decided is true, allowed is the
+// result of the check, e.g. to let super admins do everything.
+type BeforeCallback func(user auth.IUser, ability string) (allowed bool, decided bool)
+
+var (
+	mutex     sync.RWMutex
+	abilities = make(map[string]Ability)
+	befores   []BeforeCallback
+)
+
+// Define registers an ability callback.
+func Define(ability string, callback Ability) {
+	mutex.Lock()
+	abilities[ability] = callback
+	mutex.Unlock()
+}
+
+// Before registers a callback that runs before every check.
+func Before(callback BeforeCallback) {
+	mutex.Lock()
+	befores = append(befores, callback)
+	mutex.Unlock()
+}
+
+func getAbility(ability string) (Ability, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	callback, ok := abilities[ability]
+
+	return callback, ok
+}
+
+func getBefores() []BeforeCallback {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return befores
+}
+
+// Checker checks the abilities of one user. Roles and permissions are loaded
+// from the store once and kept for the life of the checker.
+type Checker struct {
+	user        auth.IUser
+	loaded      bool
+	roles       map[string]bool
+	permissions map[string]bool
+}
+
+func ForUser(user auth.IUser) *Checker {
+	return &Checker{user: user}
+}
+
+// shortcut to get the checker of the authenticated user of the request
+func Default(context echo.Context) *Checker {
+	if checker, ok := context.Get(DefaultKey).(*Checker); ok {
+		return checker
+	}
+
+	checker := ForUser(auth.Default(context).User())
+	context.Set(DefaultKey, checker)
+
+	return checker
+}
+
+func (self *Checker) User() auth.IUser {
+	return self.user
+}
+
+// Allows reports whether the user may perform the ability. Guests are never allowed.
+func (self *Checker) Allows(ability string, args ...interface{}) bool {
+	if self.user == nil {
+		return false
+	}
+
+	if allowed, decided := self.before(ability); decided {
+		return allowed
+	}
+
+	if callback, ok := getAbility(ability); ok {
+		return callback(self.user, args...)
+	}
+
+	if len(args) > 0 {
+		if allowed, ok := checkPolicy(self.user, ability, args[0]); ok {
+			return allowed
+		}
+	}
+
+	return self.HasPermission(ability)
+}
+
+// before runs the Before callbacks until one decides.
+func (self *Checker) before(ability string) (allowed bool, decided bool) {
+	for _, before := range getBefores() {
+		if allowed, decided := before(self.user, ability); decided {
+			return allowed, true
+		}
+	}
+
+	return false, false
+}
+
+func (self *Checker) Denies(ability string, args ...interface{}) bool {
+	return !self.Allows(ability, args...)
+}
+
+// Any reports whether the user may perform any of the abilities.
+func (self *Checker) Any(abilities []string, args ...interface{}) bool {
+	for _, ability := range abilities {
+		if self.Allows(ability, args...) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *Checker) HasRole(roles ...string) bool {
+	self.load()
+
+	for _, role := range roles {
+		if self.roles[role] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *Checker) HasPermission(permission string) bool {
+	self.load()
+
+	return self.permissions[permission]
+}
+
+func (self *Checker) load() {
+	if self.loaded {
+		return
+	}
+
+	self.loaded = true
+	self.roles = make(map[string]bool)
+	self.permissions = make(map[string]bool)
+
+	if self.user == nil {
+		return
+	}
+
+	var store = GetStore()
+	var userId = conv.String(self.user.GetId())
+
+	if roles, err := store.Roles(userId); err == nil {
+		for _, role := range roles {
+			self.roles[role] = true
+		}
+	}
+
+	if permissions, err := store.Permissions(userId); err == nil {
+		for _, permission := range permissions {
+			self.permissions[permission] = true
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package gate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
+	"github.com/dulumao/Guten-framework/app/core/model"
+	"github.com/labstack/echo"
+)
+
+type testUser struct {
+	id int
+}
+
+func (self *testUser) GetId() interface{} {
+	return self.id
+}
+
+func (self *testUser) GetPassword() string {
+	return ""
+}
+
+type testPost struct {
+	UserId int
+}
+
+func (self *testPost) TableName() string {
+	return "post"
+}
+
+type testPostPolicy struct{}
+
+func (self *testPostPolicy) View(user auth.IUser, m model.IModel) bool {
+	return true
+}
+
+func (self *testPostPolicy) Update(user auth.IUser, m model.IModel) bool {
+	return m.(*testPost).UserId == user.GetId()
+}
+
+func (self *testPostPolicy) Delete(user auth.IUser, m model.IModel) bool {
+	return false
+}
+
+func TestChecker(t *testing.T) {
+	store := NewMemoryStore()
+	store.GrantPermission("editor", "post.edit")
+	store.AssignRole("1", "editor")
+	SetStore(store)
+	defer SetStore(new(GormStore))
+
+	Policy(new(testPost), new(testPostPolicy))
+	Define("post.publish", func(user auth.IUser, args ...interface{}) bool {
+		return user.GetId() == 2
+	})
+
+	editor := ForUser(&testUser{id: 1})
+	other := ForUser(&testUser{id: 2})
+	post := &testPost{UserId: 1}
+
+	if !editor.Allows("post.edit") || other.Allows("post.edit") {
+		t.Error("expect post.edit through the editor role only")
+	}
+
+	if !editor.Allows(AbilityUpdate, post) || other.Allows(AbilityUpdate, post) {
+		t.Error("expect only the author to update the post")
+	}
+
+	if editor.Allows(AbilityDelete, post) || !other.Allows(AbilityView, post) {
+		t.Error("unexpected policy result")
+	}
+
+	if editor.Allows("post.publish") || !other.Allows("post.publish") {
+		t.Error("expect the defined ability to decide")
+	}
+
+	if ForUser(nil).Allows(AbilityView, post) {
+		t.Error("expect guests to be denied")
+	}
+
+	if !editor.HasRole("admin", "editor") || other.HasRole("editor") {
+		t.Error("unexpected roles")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	store := NewMemoryStore()
+	store.GrantPermission("editor", "post.edit")
+	store.AssignRole("1", "editor")
+	SetStore(store)
+	defer SetStore(new(GormStore))
+
+	auth.RegisterGuard("gate_test", func(name string, c echo.Context) auth.IGuard {
+		guard := auth.NewTokenGuard(name, nil, c)
+
+		if id := c.QueryParam("user"); id == "1" {
+			guard.Login(&testUser{id: 1})
+		} else if id == "2" {
+			guard.Login(&testUser{id: 2})
+		} else if id == "3" {
+			guard.Login(&testUser{id: 3})
+		}
+
+		return guard
+	})
+	auth.SetDefaultGuard("gate_test")
+	defer auth.SetDefaultGuard("web")
+
+	// user 3 is a super admin without roles
+	Before(func(user auth.IUser, ability string) (bool, bool) {
+		return true, user.GetId() == 3
+	})
+
+	app := echo.New()
+	app.GET("/edit", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RequirePermission("post.edit"))
+	app.GET("/editors", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RequireRole("editor"))
+
+	for _, path := range []string{"/edit", "/editors"} {
+		for query, code := range map[string]int{"": http.StatusUnauthorized, "?user=2": http.StatusForbidden, "?user=1": http.StatusOK, "?user=3": http.StatusOK} {
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+query, nil))
+
+			if rec.Code != code {
+				t.Errorf("%s%s: expect %d, got %d", path, query, code, rec.Code)
+			}
+		}
+	}
+}
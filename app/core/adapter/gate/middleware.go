@@ -0,0 +1,61 @@
+package gate
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// RequirePermission rejects requests of users that are not allowed all of
+// the permissions. They are checked with Allows, so the Before callbacks and
+// the Defined abilities decide before the roles of the user.
+func RequirePermission(permissions ...string) echo.MiddlewareFunc {
+	return require(func(checker *Checker) bool {
+		for _, permission := range permissions {
+			if !checker.Allows(permission) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// RequireRole rejects requests of users that have none of the roles. The
+// Before callbacks decide first, with the ability "role:<name>" of each role.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return require(func(checker *Checker) bool {
+		for _, role := range roles {
+			if allowed, decided := checker.before("role:" + role); decided {
+				return allowed
+			}
+		}
+
+		return checker.HasRole(roles...)
+	})
+}
+
+// Authorize rejects requests of users that are not allowed the ability.
+func Authorize(ability string) echo.MiddlewareFunc {
+	return require(func(checker *Checker) bool {
+		return checker.Allows(ability)
+	})
+}
+
+func require(allowed func(checker *Checker) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			checker := Default(context)
+
+			if checker.User() == nil {
+				return echo.ErrUnauthorized
+			}
+
+			if !allowed(checker) {
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
+
+			return next(context)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package gate
+
+import (
+	"reflect"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
+	"github.com/dulumao/Guten-framework/app/core/model"
+)
+
+const (
+	AbilityView   = "view"
+	AbilityUpdate = "update"
+	AbilityDelete = "delete"
+)
+
+// IPolicy decides what a user may do with a model.
+type IPolicy interface {
+	View(user auth.IUser, model model.IModel) bool
+	Update(user auth.IUser, model model.IModel) bool
+	Delete(user auth.IUser, model model.IModel) bool
+}
+
+var policies = make(map[reflect.Type]IPolicy)
+
+// Policy registers the policy of a model, e.g. gate.Policy(new(Post), new(PostPolicy)).
+func Policy(instance model.IModel, policy IPolicy) {
+	mutex.Lock()
+	policies[modelType(instance)] = policy
+	mutex.Unlock()
+}
+
+func getPolicy(instance model.IModel) (IPolicy, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	policy, ok := policies[modelType(instance)]
+
+	return policy, ok
+}
+
+func modelType(instance model.IModel) reflect.Type {
+	var t = reflect.TypeOf(instance)
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// checkPolicy returns ok false if arg has no policy or the ability is not a policy method.
+func checkPolicy(user auth.IUser, ability string, arg interface{}) (allowed bool, ok bool) {
+	instance, isModel := arg.(model.IModel)
+
+	if !isModel {
+		return false, false
+	}
+
+	policy, found := getPolicy(instance)
+
+	if !found {
+		return false, false
+	}
+
+	switch ability {
+	case AbilityView:
+		return policy.View(user, instance), true
+	case AbilityUpdate:
+		return policy.Update(user, instance), true
+	case AbilityDelete:
+		return policy.Delete(user, instance), true
+	}
+
+	return false, false
+}
@@ -0,0 +1,236 @@
+package gate
+
+import (
+	"sync"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/database"
+)
+
+type Role struct {
+	Id   uint   `gorm:"primary_key"`
+	Name string `gorm:"size:191;unique_index"`
+}
+
+func (self *Role) TableName() string {
+	return "roles"
+}
+
+type Permission struct {
+	Id   uint   `gorm:"primary_key"`
+	Name string `gorm:"size:191;unique_index"`
+}
+
+func (self *Permission) TableName() string {
+	return "permissions"
+}
+
+type RolePermission struct {
+	RoleId       uint `gorm:"primary_key;auto_increment:false"`
+	PermissionId uint `gorm:"primary_key;auto_increment:false"`
+}
+
+func (self *RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+type UserRole struct {
+	UserId string `gorm:"primary_key;size:64"`
+	RoleId uint   `gorm:"primary_key;auto_increment:false"`
+}
+
+func (self *UserRole) TableName() string {
+	return "user_roles"
+}
+
+// IStore loads and assigns roles and permissions.
+type IStore interface {
+	Roles(userId string) ([]string, error)
+	Permissions(userId string) ([]string, error)
+	AssignRole(userId string, role string) error
+	RevokeRole(userId string, role string) error
+	GrantPermission(role string, permission string) error
+	RevokePermission(role string, permission string) error
+}
+
+var (
+	storeMutex sync.RWMutex
+	store      IStore = new(GormStore)
+)
+
+func SetStore(s IStore) {
+	storeMutex.Lock()
+	store = s
+	storeMutex.Unlock()
+}
+
+func GetStore() IStore {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return store
+}
+
+// GormStore keeps roles and permissions in the roles, permissions,
+// role_permissions and user_roles tables.
+type GormStore struct{}
+
+func (self *GormStore) Roles(userId string) ([]string, error) {
+	var names []string
+
+	err := database.DB.Table("roles").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Pluck("roles.name", &names).Error
+
+	return names, err
+}
+
+func (self *GormStore) Permissions(userId string) ([]string, error) {
+	var names []string
+
+	err := database.DB.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userId).
+		Pluck("DISTINCT permissions.name", &names).Error
+
+	return names, err
+}
+
+func (self *GormStore) AssignRole(userId string, role string) error {
+	var r = Role{Name: role}
+
+	if err := database.DB.Where(r).FirstOrCreate(&r).Error; err != nil {
+		return err
+	}
+
+	return database.DB.FirstOrCreate(&UserRole{}, UserRole{UserId: userId, RoleId: r.Id}).Error
+}
+
+func (self *GormStore) RevokeRole(userId string, role string) error {
+	var r Role
+
+	if err := database.DB.Where("name = ?", role).First(&r).Error; err != nil {
+		return err
+	}
+
+	return database.DB.Where("user_id = ? AND role_id = ?", userId, r.Id).Delete(UserRole{}).Error
+}
+
+func (self *GormStore) GrantPermission(role string, permission string) error {
+	var r = Role{Name: role}
+	var p = Permission{Name: permission}
+
+	if err := database.DB.Where(r).FirstOrCreate(&r).Error; err != nil {
+		return err
+	}
+
+	if err := database.DB.Where(p).FirstOrCreate(&p).Error; err != nil {
+		return err
+	}
+
+	return database.DB.FirstOrCreate(&RolePermission{}, RolePermission{RoleId: r.Id, PermissionId: p.Id}).Error
+}
+
+func (self *GormStore) RevokePermission(role string, permission string) error {
+	var r Role
+	var p Permission
+
+	if err := database.DB.Where("name = ?", role).First(&r).Error; err != nil {
+		return err
+	}
+
+	if err := database.DB.Where("name = ?", permission).First(&p).Error; err != nil {
+		return err
+	}
+
+	return database.DB.Where("role_id = ? AND permission_id = ?", r.Id, p.Id).Delete(RolePermission{}).Error
+}
+
+// MemoryStore keeps roles and permissions in memory, for tests.
+type MemoryStore struct {
+	mutex       sync.RWMutex
+	userRoles   map[string]map[string]bool
+	permissions map[string]map[string]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		userRoles:   make(map[string]map[string]bool),
+		permissions: make(map[string]map[string]bool),
+	}
+}
+
+func (self *MemoryStore) Roles(userId string) ([]string, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var names []string
+
+	for role := range self.userRoles[userId] {
+		names = append(names, role)
+	}
+
+	return names, nil
+}
+
+func (self *MemoryStore) Permissions(userId string) ([]string, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var seen = make(map[string]bool)
+	var names []string
+
+	for role := range self.userRoles[userId] {
+		for permission := range self.permissions[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				names = append(names, permission)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func (self *MemoryStore) AssignRole(userId string, role string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.userRoles[userId] == nil {
+		self.userRoles[userId] = make(map[string]bool)
+	}
+
+	self.userRoles[userId][role] = true
+
+	return nil
+}
+
+func (self *MemoryStore) RevokeRole(userId string, role string) error {
+	self.mutex.Lock()
+	delete(self.userRoles[userId], role)
+	self.mutex.Unlock()
+
+	return nil
+}
+
+func (self *MemoryStore) GrantPermission(role string, permission string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.permissions[role] == nil {
+		self.permissions[role] = make(map[string]bool)
+	}
+
+	self.permissions[role][permission] = true
+
+	return nil
+}
+
+func (self *MemoryStore) RevokePermission(role string, permission string) error {
+	self.mutex.Lock()
+	delete(self.permissions[role], permission)
+	self.mutex.Unlock()
+
+	return nil
+}
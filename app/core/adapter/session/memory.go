@@ -0,0 +1,262 @@
+package session
+
+import (
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// IMemoryStore keeps sessions in process memory. It is meant for tests and
+// single instance development servers, the contents are lost on restart.
+type IMemoryStore interface {
+	IStore
+	// Sessions returns the IDs of all sessions that have not expired.
+	Sessions() []string
+	// Values returns a copy of the values stored for the session ID.
+	Values(id string) (map[interface{}]interface{}, bool)
+	// Put replaces the values of the session ID, creating it if needed.
+	Put(id string, values map[interface{}]interface{})
+	// Remove deletes the session ID.
+	Remove(id string)
+	// Flush deletes all sessions.
+	Flush()
+	// Cookie returns the cookie a client must send to resume the session ID.
+	Cookie(name, id string) (*http.Cookie, error)
+}
+
+type memoryItem struct {
+	values    map[interface{}]interface{}
+	expiresAt time.Time
+}
+
+func (self *memoryItem) isExpired(now time.Time) bool {
+	return !self.expiresAt.IsZero() && now.After(self.expiresAt)
+}
+
+// NewMemoryStore returns a new in-memory store.
+//
+// Only the session ID is written to the cookie, encoded with the given key
+// pairs. See NewCookieStore() for a description of the parameters.
+func NewMemoryStore(keyPairs ...[]byte) IMemoryStore {
+	store := &memoryStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+		items: make(map[string]*memoryItem),
+	}
+
+	store.MaxAge(store.options.MaxAge)
+
+	return store
+}
+
+// memoryReapInterval is the minimum time between two removals of the
+// expired sessions, they are removed by the writes.
+const memoryReapInterval = time.Minute
+
+type memoryStore struct {
+	Codecs  []securecookie.Codec
+	options *sessions.Options
+	mutex   sync.RWMutex
+	items   map[string]*memoryItem
+	reaped  time.Time
+}
+
+func (self *memoryStore) Options(options Options) {
+	self.mutex.Lock()
+	self.options = &sessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+	self.mutex.Unlock()
+
+	self.MaxAge(options.MaxAge)
+}
+
+// MaxAge sets the lifetime of new sessions and of the underlying cookie codecs.
+func (self *memoryStore) MaxAge(age int) {
+	self.mutex.Lock()
+	self.options.MaxAge = age
+	self.mutex.Unlock()
+
+	for _, codec := range self.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (self *memoryStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(self, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (self *memoryStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	sess := sessions.NewSession(self, name)
+	opts := self.sessionOptions()
+	sess.Options = &opts
+	sess.IsNew = true
+
+	c, err := r.Cookie(name)
+
+	if err != nil {
+		return sess, nil
+	}
+
+	if err = securecookie.DecodeMulti(name, c.Value, &sess.ID, self.Codecs...); err != nil {
+		return sess, err
+	}
+
+	if values, ok := self.Values(sess.ID); ok {
+		sess.Values = values
+		sess.IsNew = false
+	}
+
+	return sess, nil
+}
+
+// Save stores the session values and writes the session ID cookie.
+// A session with Options.MaxAge <= 0 is removed from the store.
+func (self *memoryStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	if sess.Options.MaxAge <= 0 {
+		self.Remove(sess.ID)
+		http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+
+		return nil
+	}
+
+	if sess.ID == "" {
+		sess.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+
+	self.put(sess.ID, sess.Values, sess.Options.MaxAge)
+
+	encoded, err := securecookie.EncodeMulti(sess.Name(), sess.ID, self.Codecs...)
+
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), encoded, sess.Options))
+
+	return nil
+}
+
+func (self *memoryStore) Sessions() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.reap(time.Now())
+
+	var ids = make([]string, 0, len(self.items))
+
+	for id := range self.items {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (self *memoryStore) Values(id string) (map[interface{}]interface{}, bool) {
+	self.mutex.RLock()
+	item, ok := self.items[id]
+	self.mutex.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	if item.isExpired(time.Now()) {
+		self.Remove(id)
+
+		return nil, false
+	}
+
+	return copyValues(item.values), true
+}
+
+func (self *memoryStore) Put(id string, values map[interface{}]interface{}) {
+	self.put(id, values, self.sessionOptions().MaxAge)
+}
+
+func (self *memoryStore) put(id string, values map[interface{}]interface{}, maxAge int) {
+	var now = time.Now()
+	var item = &memoryItem{values: copyValues(values)}
+
+	if maxAge > 0 {
+		item.expiresAt = now.Add(time.Duration(maxAge) * time.Second)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.items[id] = item
+
+	if now.Sub(self.reaped) >= memoryReapInterval {
+		self.reap(now)
+	}
+}
+
+// reap removes the expired sessions, the caller holds the write lock.
+func (self *memoryStore) reap(now time.Time) {
+	for id, item := range self.items {
+		if item.isExpired(now) {
+			delete(self.items, id)
+		}
+	}
+
+	self.reaped = now
+}
+
+// sessionOptions returns a copy of the options of new sessions.
+func (self *memoryStore) sessionOptions() sessions.Options {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	return *self.options
+}
+
+func (self *memoryStore) Remove(id string) {
+	self.mutex.Lock()
+	delete(self.items, id)
+	self.mutex.Unlock()
+}
+
+func (self *memoryStore) Flush() {
+	self.mutex.Lock()
+	self.items = make(map[string]*memoryItem)
+	self.mutex.Unlock()
+}
+
+func (self *memoryStore) Cookie(name, id string) (*http.Cookie, error) {
+	encoded, err := securecookie.EncodeMulti(name, id, self.Codecs...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var options = self.sessionOptions()
+
+	return sessions.NewCookie(name, encoded, &options), nil
+}
+
+func copyValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	var dst = make(map[interface{}]interface{}, len(values))
+
+	for k, v := range values {
+		dst[k] = v
+	}
+
+	return dst
+}
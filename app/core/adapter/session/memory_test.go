@@ -0,0 +1,127 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+func TestMemoryStore_Handler(t *testing.T) {
+	store := NewMemoryStore([]byte("secret"))
+	store.Options(Options{Path: "/", MaxAge: 3600})
+	store.Put("user-1", map[interface{}]interface{}{"auth_web": 1})
+
+	app := echo.New()
+	app.Use(New("session", store))
+	app.GET("/", func(c echo.Context) error {
+		sess := Default(c)
+
+		if sess.Get("auth_web") != 1 {
+			t.Errorf("expect auth_web 1, got %v", sess.Get("auth_web"))
+		}
+
+		sess.Set("visited", true)
+
+		return sess.Save()
+	})
+
+	cookie, err := store.Cookie("session", "user-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	values, ok := store.Values("user-1")
+
+	if !ok {
+		t.Fatal("expect session user-1 to exist")
+	}
+
+	if values["visited"] != true {
+		t.Errorf("expect visited true, got %v", values["visited"])
+	}
+
+	if ids := store.Sessions(); len(ids) != 1 || ids[0] != "user-1" {
+		t.Errorf("expect [user-1], got %v", ids)
+	}
+}
+
+func TestMemoryStore_NewSession(t *testing.T) {
+	store := NewMemoryStore([]byte("secret"))
+
+	app := echo.New()
+	app.Use(New("session", store))
+	app.GET("/", func(c echo.Context) error {
+		sess := Default(c)
+		sess.Set("name", "guten")
+
+		return sess.Save()
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	ids := store.Sessions()
+
+	if len(ids) != 1 {
+		t.Fatalf("expect 1 session, got %d", len(ids))
+	}
+
+	if values, _ := store.Values(ids[0]); values["name"] != "guten" {
+		t.Errorf("expect name guten, got %v", values["name"])
+	}
+
+	if len(rec.Result().Cookies()) == 0 {
+		t.Error("expect session cookie to be set")
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	store := NewMemoryStore([]byte("secret"))
+	store.Put("expired", map[interface{}]interface{}{"a": 1})
+	store.(*memoryStore).items["expired"].expiresAt = time.Now().Add(-time.Second)
+
+	if _, ok := store.Values("expired"); ok {
+		t.Error("expect expired session to be gone")
+	}
+
+	store.Put("kept", map[interface{}]interface{}{"a": 1})
+	store.Flush()
+
+	if len(store.Sessions()) != 0 {
+		t.Error("expect no sessions after flush")
+	}
+}
+
+func TestMemoryStore_Reap(t *testing.T) {
+	store := NewMemoryStore([]byte("secret")).(*memoryStore)
+	store.Put("idle", map[interface{}]interface{}{"a": 1})
+	store.items["idle"].expiresAt = time.Now().Add(-time.Second)
+
+	// writes remove the expired sessions once per interval
+	store.reaped = time.Now().Add(-memoryReapInterval)
+	store.Put("active", map[interface{}]interface{}{"a": 1})
+
+	if _, ok := store.items["idle"]; ok {
+		t.Error("expect the idle session to be reaped on write")
+	}
+
+	store.Put("idle", map[interface{}]interface{}{"a": 1})
+	store.items["idle"].expiresAt = time.Now().Add(-time.Second)
+
+	if ids := store.Sessions(); len(ids) != 1 || ids[0] != "active" {
+		t.Errorf("expect [active], got %v", ids)
+	}
+
+	if _, ok := store.items["idle"]; ok {
+		t.Error("expect Sessions to reap the idle session")
+	}
+}
@@ -129,6 +129,32 @@ func (s *session) Options(options Options) {
 	}
 }
 
+// IRegenerator is implemented by sessions that can change their ID, e.g.
+// after a login so an ID known before the login is useless afterwards.
+type IRegenerator interface {
+	// Regenerate gives the session a new ID on the next Save, keeping its
+	// values. Stores that support it forget the old ID.
+	Regenerate() error
+}
+
+func (s *session) Regenerate() error {
+	sess := s.Session()
+
+	if sess == nil {
+		return nil
+	}
+
+	if remover, ok := s.store.(interface{ Remove(id string) }); ok && sess.ID != "" {
+		remover.Remove(sess.ID)
+	}
+
+	sess.ID = ""
+	sess.IsNew = true
+	s.written = true
+
+	return nil
+}
+
 func (s *session) Save() error {
 	if s.Written() {
 		e := s.Session().Save(s.request, s.writer)
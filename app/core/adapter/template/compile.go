@@ -0,0 +1,210 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CloudyKit/jet"
+)
+
+// Extensions are the file extensions of templates, the names of templates
+// are looked up without them, e.g. "error/fail" for "error/fail.jet".
+var Extensions = []string{".html.jet", ".jet.html", ".jet"}
+
+// compiled is a template parsed in development mode and the files it was
+// parsed from, its own file and the files it extends and imports.
+type compiled struct {
+	template *jet.Template
+	files    map[string]bool
+}
+
+// recordingLoader notes the files opened while a template is compiled and
+// runs the source filters on them.
+type recordingLoader struct {
+	ILoader
+
+	mutex   sync.Mutex
+	files   map[string]bool
+	sources []ISourceFilter
+}
+
+func (self *recordingLoader) Open(name string) (io.ReadCloser, error) {
+	self.mutex.Lock()
+
+	if self.files != nil {
+		self.files[filepath.Clean(name)] = true
+	}
+
+	self.mutex.Unlock()
+
+	f, err := self.ILoader.Open(name)
+
+	if err != nil || len(self.sources) == 0 {
+		return f, err
+	}
+
+	defer f.Close()
+
+	source, err := ioutil.ReadAll(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filter := range self.sources {
+		source = filter.FilterSource(name, source)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(source)), nil
+}
+
+// AddPath adds a directory to loaders that support it, for jet.Set.AddPath.
+func (self *recordingLoader) AddPath(path string) {
+	if loader, ok := self.ILoader.(interface{ AddPath(string) }); ok {
+		loader.AddPath(path)
+	} else {
+		panic(fmt.Sprintf("AddPath() not supported on loader of type %T", self.ILoader))
+	}
+}
+
+func (self *recordingLoader) record(fn func()) map[string]bool {
+	self.mutex.Lock()
+	self.files = make(map[string]bool)
+	self.mutex.Unlock()
+
+	fn()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var files = self.files
+	self.files = nil
+
+	return files
+}
+
+// template returns the compiled template. Cached renderers use the cache of
+// jet, watched renderers keep the templates until one of their files
+// changes, other renderers parse the template on every call.
+func (self *Renderer) template(name string) (*jet.Template, error) {
+	if self.Cached || self.stop == nil {
+		return self.Engine.GetTemplate(name)
+	}
+
+	self.tmx.RLock()
+	entry, ok := self.templates[name]
+	self.tmx.RUnlock()
+
+	if ok {
+		return entry.template, nil
+	}
+
+	self.tmx.Lock()
+	defer self.tmx.Unlock()
+
+	if entry, ok = self.templates[name]; ok {
+		return entry.template, nil
+	}
+
+	var t *jet.Template
+	var err error
+
+	files := self.loader.record(func() {
+		t, err = self.Engine.GetTemplate(name)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	self.templates[name] = &compiled{template: t, files: files}
+
+	return t, nil
+}
+
+// Precompile parses every template of the template directories, so syntax
+// errors are found at boot instead of on the first request. The error lists
+// all templates that failed.
+func (self *Renderer) Precompile() error {
+	var failures []string
+
+	for _, name := range self.loader.List() {
+		if _, err := self.template(name); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("template: %d templates failed to compile:\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+// Watch caches the templates of a development renderer and polls the files
+// of the loader with the interval, a changed, added or removed file only
+// drops the templates that were parsed from it. Cached renderers and
+// loaders that are not IWatchableLoader do not watch.
+func (self *Renderer) Watch(interval time.Duration) {
+	watchable, ok := self.loader.ILoader.(IWatchableLoader)
+
+	if self.Cached || self.stop != nil || !ok {
+		return
+	}
+
+	self.stop = make(chan struct{})
+	files := watchable.ModTimes()
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				current := watchable.ModTimes()
+
+				for file, modTime := range current {
+					if previous, ok := files[file]; !ok || !previous.Equal(modTime) {
+						self.invalidate(file)
+					}
+				}
+
+				for file := range files {
+					if _, ok := current[file]; !ok {
+						self.invalidate(file)
+					}
+				}
+
+				files = current
+			}
+		}
+	}(self.stop)
+}
+
+// Close stops watching the template directories.
+func (self *Renderer) Close() {
+	if self.stop != nil {
+		self.closeOnce.Do(func() { close(self.stop) })
+	}
+}
+
+// invalidate drops the templates parsed from the file.
+func (self *Renderer) invalidate(file string) {
+	self.tmx.Lock()
+	defer self.tmx.Unlock()
+
+	for name, entry := range self.templates {
+		if entry.files[file] {
+			delete(self.templates, name)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/CloudyKit/jet"
+)
+
+// viewKey is the variable holding the state of a render.
+const viewKey = "_view"
+
+var stackPattern = regexp.MustCompile(`<!--stack:([^>]*)-->`)
+
+// HTML is written to the template without escaping, like the slots of
+// components.
+type HTML string
+
+// Render implements jet.Renderer.
+func (self HTML) Render(runtime *jet.Runtime) {
+	io.WriteString(runtime.Writer, string(self))
+}
+
+var components = struct {
+	sync.RWMutex
+	templates map[string]string
+}{templates: make(map[string]string)}
+
+// RegisterComponent sets the template of a component, by default the
+// component "alert" is the template "components/alert" and "blog::alert"
+// is "blog::components/alert".
+func RegisterComponent(name, template string) {
+	components.Lock()
+	components.templates[name] = template
+	components.Unlock()
+}
+
+func componentTemplate(name string) string {
+	components.RLock()
+	template, ok := components.templates[name]
+	components.RUnlock()
+
+	if ok {
+		return template
+	}
+
+	if ns, name := SplitNamespace(name); ns != "" {
+		return ns + NamespaceSeparator + "components/" + name
+	}
+
+	return "components/" + name
+}
+
+// capture is an open push, component or slot, the output written until it
+// is closed.
+type capture struct {
+	kind   string
+	name   string
+	props  interface{}
+	slots  map[string]HTML
+	writer io.Writer
+	buf    *bytes.Buffer
+}
+
+// viewState is the state shared by the templates of one render, the view
+// and the components it renders.
+type viewState struct {
+	renderer *Renderer
+	vars     jet.VarMap
+	stacks   map[string]*bytes.Buffer
+	captures []*capture
+}
+
+func newViewState(renderer *Renderer, vars jet.VarMap) *viewState {
+	var self = &viewState{renderer: renderer, vars: vars, stacks: make(map[string]*bytes.Buffer)}
+	vars.Set(viewKey, self)
+
+	return self
+}
+
+func (self *viewState) begin(runtime *jet.Runtime, kind, name string) *capture {
+	var c = &capture{kind: kind, name: name, writer: runtime.Writer, buf: new(bytes.Buffer)}
+
+	self.captures = append(self.captures, c)
+	runtime.Writer = c.buf
+
+	return c
+}
+
+func (self *viewState) end(runtime *jet.Runtime, kind string) *capture {
+	if len(self.captures) == 0 || self.captures[len(self.captures)-1].kind != kind {
+		panic(fmt.Errorf("end%s without %s", kind, kind))
+	}
+
+	var c = self.captures[len(self.captures)-1]
+
+	self.captures = self.captures[:len(self.captures)-1]
+	runtime.Writer = c.writer
+
+	return c
+}
+
+// close checks that every capture was closed.
+func (self *viewState) close() error {
+	if len(self.captures) > 0 {
+		var c = self.captures[len(self.captures)-1]
+
+		return fmt.Errorf("%s %q is not closed with end%s", c.kind, c.name, c.kind)
+	}
+
+	return nil
+}
+
+// fillStacks replaces the placeholders of stack with the pushed content,
+// stacks are filled after rendering so layouts get the pushes of the views.
+func (self *viewState) fillStacks(out []byte) []byte {
+	return stackPattern.ReplaceAllFunc(out, func(placeholder []byte) []byte {
+		name := string(stackPattern.FindSubmatch(placeholder)[1])
+
+		if stack, ok := self.stacks[name]; ok {
+			return stack.Bytes()
+		}
+
+		return nil
+	})
+}
+
+// component renders the component with the props and slots into w.
+func (self *viewState) component(w io.Writer, name string, props interface{}, slots map[string]HTML) error {
+	t, err := self.renderer.template(componentTemplate(name))
+
+	if err != nil {
+		return err
+	}
+
+	var vars = make(jet.VarMap, len(self.vars)+3)
+
+	for key, value := range self.vars {
+		vars[key] = value
+	}
+
+	vars.Set("props", props)
+	vars.Set("slot", slots["default"])
+	vars.Set("slots", slots)
+
+	return self.renderer.execute(t, w, vars, props)
+}
+
+func resolveViewState(a jet.Arguments) *viewState {
+	state, ok := a.Runtime().Resolve(viewKey).Interface().(*viewState)
+
+	if !ok {
+		a.Panicf("templates helpers need a render of the Renderer")
+	}
+
+	return state
+}
+
+func stringArgument(a jet.Arguments, i int, fn string) string {
+	var v = a.Get(i)
+
+	if !v.IsValid() || v.Kind() != reflect.String {
+		a.Panicf("%s: the name must be a string", fn)
+	}
+
+	return v.String()
+}
+
+// addViewFuncs registers the helpers for components and stacks:
+//
+//	{{ push("scripts") }}<script src="/app.js"></script>{{ endpush() }}
+//	{{ stack("scripts") }}
+//
+//	{{ component("alert", map("type", "danger")) }}
+//	    Default slot
+//	    {{ slot("footer") }}Named slot{{ endslot() }}
+//	{{ endcomponent() }}
+//
+// The template "components/alert" gets the props as data and in props, the
+// default slot in slot and the named slots in slots.
+func (self *Renderer) addViewFuncs() {
+	self.Engine.AddGlobalFunc("push", func(a jet.Arguments) reflect.Value {
+		a.RequireNumOfArguments("push", 1, 1)
+		resolveViewState(a).begin(a.Runtime(), "push", stringArgument(a, 0, "push"))
+
+		return reflect.Value{}
+	})
+	self.Engine.AddGlobalFunc("endpush", func(a jet.Arguments) reflect.Value {
+		state := resolveViewState(a)
+		c := state.end(a.Runtime(), "push")
+
+		if _, ok := state.stacks[c.name]; !ok {
+			state.stacks[c.name] = new(bytes.Buffer)
+		}
+
+		state.stacks[c.name].Write(c.buf.Bytes())
+
+		return reflect.Value{}
+	})
+	self.Engine.AddGlobalFunc("stack", func(a jet.Arguments) reflect.Value {
+		a.RequireNumOfArguments("stack", 1, 1)
+
+		return reflect.ValueOf(HTML("<!--stack:" + stringArgument(a, 0, "stack") + "-->"))
+	})
+	self.Engine.AddGlobalFunc("component", func(a jet.Arguments) reflect.Value {
+		a.RequireNumOfArguments("component", 1, 2)
+
+		var props interface{}
+
+		if a.NumOfArguments() > 1 && a.Get(1).IsValid() {
+			props = a.Get(1).Interface()
+		}
+
+		c := resolveViewState(a).begin(a.Runtime(), "component", stringArgument(a, 0, "component"))
+		c.props = props
+		c.slots = make(map[string]HTML)
+
+		return reflect.Value{}
+	})
+	self.Engine.AddGlobalFunc("slot", func(a jet.Arguments) reflect.Value {
+		a.RequireNumOfArguments("slot", 1, 1)
+		resolveViewState(a).begin(a.Runtime(), "slot", stringArgument(a, 0, "slot"))
+
+		return reflect.Value{}
+	})
+	self.Engine.AddGlobalFunc("endslot", func(a jet.Arguments) reflect.Value {
+		state := resolveViewState(a)
+		c := state.end(a.Runtime(), "slot")
+
+		if len(state.captures) == 0 || state.captures[len(state.captures)-1].kind != "component" {
+			a.Panicf("slot %q is not inside a component", c.name)
+		}
+
+		state.captures[len(state.captures)-1].slots[c.name] = HTML(c.buf.String())
+
+		return reflect.Value{}
+	})
+	self.Engine.AddGlobalFunc("endcomponent", func(a jet.Arguments) reflect.Value {
+		state := resolveViewState(a)
+		c := state.end(a.Runtime(), "component")
+		c.slots["default"] = HTML(c.buf.String())
+
+		if err := state.component(a.Runtime().Writer, c.name, c.props, c.slots); err != nil {
+			panic(err)
+		}
+
+		return reflect.Value{}
+	})
+}
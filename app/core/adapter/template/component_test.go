@@ -0,0 +1,48 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/labstack/echo"
+)
+
+func TestRenderer_Components(t *testing.T) {
+	loader := NewMemoryLoader(map[string]string{
+		"layout.jet": `<head>{{ stack("styles") }}</head><body>{{ yield body() }}</body>`,
+		"page.jet": `{{ extends "layout.jet" }}{{ block body() }}` +
+			`{{ push("styles") }}<link href="page.css">{{ endpush() }}` +
+			`{{ component("alert", map("type", "danger")) }}<b>{{ user }}</b>{{ slot("title") }}Oops{{ endslot() }}{{ endcomponent() }}` +
+			`{{ end }}`,
+		"components/alert.jet": `{{ push("styles") }}<link href="alert.css">{{ endpush() }}` +
+			`<div class="{{ .type }}"><h1>{{ slots.title }}</h1>{{ slot }}</div>`,
+		"unclosed.jet": `{{ push("scripts") }}`,
+	})
+
+	defer observer.New()
+
+	Compose("pa*", func(view *View) {
+		view.With("user", "<gopher>")
+	})
+
+	renderer := NewWithLoader(true, loader)
+	c := newTestContext(echo.New(), "")
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "page", nil, c); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<head><link href="page.css"><link href="alert.css"></head>` +
+		`<body><div class="danger"><h1>Oops</h1><b>&lt;gopher&gt;</b></div></body>`
+
+	if buf.String() != expected {
+		t.Errorf("expect\n%s\ngot\n%s", expected, buf.String())
+	}
+
+	if err := renderer.Render(&buf, "unclosed", nil, c); err == nil {
+		t.Error("expect an error for an unclosed push")
+	}
+}
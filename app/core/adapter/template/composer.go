@@ -0,0 +1,65 @@
+package template
+
+import (
+	"github.com/CloudyKit/jet"
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/dulumao/Guten-utils/os/event"
+	"github.com/labstack/echo"
+)
+
+// View is a view about to be rendered. Data is the data of the template,
+// Vars its variables. NoFilters keeps the output from the filters of the
+// renderer, e.g. for views that are not HTML.
+type View struct {
+	Name      string
+	Context   echo.Context
+	Data      interface{}
+	Vars      jet.VarMap
+	NoFilters bool
+}
+
+// With sets a variable of the template.
+func (self *View) With(name string, value interface{}) *View {
+	self.Vars.Set(name, value)
+
+	return self
+}
+
+// Composer adds data to the views it was registered for.
+type Composer func(view *View)
+
+// ComposerPriority is the priority of the listeners of Compose, they run
+// before the EventBefore listeners of the default priority 0.
+const ComposerPriority = -10
+
+// Compose registers a composer for the views matching the pattern, e.g.
+// "admin/dashboard", "admin/*" for all views below admin or "*" for all
+// views. It is a listener of EventBefore with ComposerPriority, so it is
+// ordered with the other listeners of the view; patterns with "*" run
+// after the listeners of the exact name. Like listeners composers are added
+// after core.New, which resets the observer.
+//
+//	template.Compose("layouts/*", func(view *template.View) {
+//		view.With("menu", menu.Items())
+//	})
+func Compose(pattern string, fn Composer) {
+	ComposeWithPriority(pattern, ComposerPriority, fn)
+}
+
+// ComposeWithPriority registers a composer like Compose, ordered by the
+// priority among the EventBefore listeners.
+func ComposeWithPriority(pattern string, priority int, fn Composer) {
+	observer.On(EventBefore+GetViewEventName(pattern), event.Listener{Priority: priority, Callback: func(e *event.Event) error {
+		fn(e.Data.(*ViewEvent).View)
+
+		return nil
+	}})
+}
+
+// MatchName reports whether the view name matches the pattern, a trailing
+// "*" matches the rest of the name including "/", other patterns are
+// matched with path.Match. It is observer.Match, the matcher of the
+// wildcard event listeners.
+func MatchName(pattern, name string) bool {
+	return observer.Match(pattern, name)
+}
@@ -0,0 +1,239 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SnippetLines is the number of lines shown before and after the line of a
+// template error.
+var SnippetLines = 3
+
+var (
+	// template: name:line: message
+	parseErrorPattern = regexp.MustCompile(`(?s)^template: (.+?):(\d+): (.*)$`)
+	// Jet Runtime Error("name":line): message
+	runtimeErrorPattern = regexp.MustCompile(`(?s)^Jet Runtime Error\("(.+?)":(\d+)\): (.*)$`)
+	// template name can't be loaded
+	notFoundPattern = regexp.MustCompile(`^template (.+) can't be loaded$`)
+	// the template that could not be loaded, also of an include or extends
+	missingPattern = regexp.MustCompile(`\btemplate (\S+) can't be loaded$`)
+	quotedPattern  = regexp.MustCompile(`"([^"]+)"`)
+	// jet appends the variables of the scope to unknown identifiers
+	scopePattern = regexp.MustCompile(`(?s) map\[.*\]$`)
+)
+
+// SourceLine is one line of the snippet of a template error.
+type SourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// TemplateError is returned by Render when a template can not be found,
+// parsed or executed. Line and Column are 0 when unknown, Name is the
+// template the error is in, which may be a layout or partial of the
+// rendered View.
+type TemplateError struct {
+	View     string
+	Name     string
+	File     string
+	Line     int
+	Column   int
+	Message  string
+	NotFound bool
+	Snippet  []SourceLine
+	Err      error
+}
+
+func (self *TemplateError) Error() string {
+	var location = self.Name
+
+	if self.Line > 0 {
+		location += ":" + strconv.Itoa(self.Line)
+	}
+
+	if self.Column > 0 {
+		location += ":" + strconv.Itoa(self.Column)
+	}
+
+	return fmt.Sprintf("template: %s: %s", location, self.Message)
+}
+
+func (self *TemplateError) Unwrap() error {
+	return self.Err
+}
+
+// StartLine is the number of the first line of the snippet.
+func (self *TemplateError) StartLine() int {
+	if len(self.Snippet) == 0 {
+		return 0
+	}
+
+	return self.Snippet[0].Number
+}
+
+// Source joins the lines of the snippet.
+func (self *TemplateError) Source() string {
+	var lines = make([]string, len(self.Snippet))
+
+	for i, line := range self.Snippet {
+		lines[i] = line.Text
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// templateError turns an error of jet, or a value recovered while executing
+// the view, into a TemplateError.
+func (self *Renderer) templateError(view string, cause interface{}) *TemplateError {
+	err, ok := cause.(error)
+
+	if !ok {
+		err = fmt.Errorf("%v", cause)
+	}
+
+	if templateErr, ok := err.(*TemplateError); ok {
+		return templateErr
+	}
+
+	var templateErr = &TemplateError{View: view, Name: view, Message: err.Error(), Err: err}
+
+	if match := parseErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		templateErr.Name, templateErr.Message = match[1], match[3]
+		templateErr.Line, _ = strconv.Atoi(match[2])
+	} else if match := runtimeErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		templateErr.Name, templateErr.Message = match[1], scopePattern.ReplaceAllString(match[3], "")
+		templateErr.Line, _ = strconv.Atoi(match[2])
+	} else if match := notFoundPattern.FindStringSubmatch(err.Error()); match != nil {
+		templateErr.Name, templateErr.Message = match[1], "can't be loaded"
+		templateErr.NotFound = true
+	}
+
+	// only a template no loader of the chain had can be of an unknown
+	// namespace, errors inside found templates are kept
+	if match := missingPattern.FindStringSubmatch(err.Error()); match != nil {
+		if ns, _ := SplitNamespace(match[1]); ns != "" && !self.hasNamespace(ns) {
+			templateErr.Message = fmt.Sprintf("unknown namespace %q", ns)
+			templateErr.NotFound = true
+			templateErr.Err = ErrUnknownNamespace
+		}
+	}
+
+	templateErr.Name = strings.TrimPrefix(templateErr.Name, "/")
+
+	if file, ok := self.resolve(templateErr.Name); ok {
+		templateErr.File = file
+
+		if templateErr.Line > 0 {
+			// the source as written, without the changes of source filters
+			if f, err := self.loader.ILoader.Open(file); err == nil {
+				templateErr.readSnippet(f)
+				f.Close()
+			}
+		}
+	}
+
+	return templateErr
+}
+
+// readSnippet reads the lines around the error and guesses the column from
+// the first quoted token of the message found on the line.
+func (self *TemplateError) readSnippet(r io.Reader) {
+	content, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return
+	}
+
+	var lines = strings.Split(string(content), "\n")
+
+	if self.Line > len(lines) {
+		return
+	}
+
+	var start = self.Line - SnippetLines
+	var end = self.Line + SnippetLines
+
+	if start < 1 {
+		start = 1
+	}
+
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	for number := start; number <= end; number++ {
+		self.Snippet = append(self.Snippet, SourceLine{
+			Number:  number,
+			Text:    strings.TrimRight(lines[number-1], "\r"),
+			Current: number == self.Line,
+		})
+	}
+
+	for _, match := range quotedPattern.FindAllStringSubmatch(self.Message, -1) {
+		if i := strings.Index(lines[self.Line-1], match[1]); i >= 0 {
+			self.Column = i + 1
+			break
+		}
+	}
+}
+
+// hasNamespace reports whether the namespace is registered in the registry
+// of the loaders of the renderer. A namespace that is not is recorded there.
+func (self *Renderer) hasNamespace(name string) bool {
+	var registry = findNamespaces(self.loader.ILoader)
+
+	if registry == nil {
+		return false
+	}
+
+	if registry.Has(name) {
+		return true
+	}
+
+	registry.markUnknown(name)
+
+	return false
+}
+
+// findNamespaces returns the namespace registry of the loader or of the
+// loaders of a chain, nil if there is none.
+func findNamespaces(loader ILoader) *NamespaceRegistry {
+	switch loader := loader.(type) {
+	case *NamespaceRegistry:
+		return loader
+	case *ChainLoader:
+		loader.mutex.RLock()
+		var loaders = loader.loaders
+		loader.mutex.RUnlock()
+
+		for _, loader := range loaders {
+			if registry := findNamespaces(loader); registry != nil {
+				return registry
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the file of the template name, like jet tries the name
+// with and without Extensions.
+func (self *Renderer) resolve(name string) (string, bool) {
+	if file, ok := self.loader.Exists(name); ok {
+		return file, true
+	}
+
+	for _, extension := range Extensions {
+		if file, ok := self.loader.Exists(name + extension); ok {
+			return file, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,92 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/dulumao/Guten-utils/os/event"
+	"github.com/dulumao/Guten-utils/safemap"
+)
+
+const (
+	// EventBefore is emitted with a *ViewEvent before the view is executed,
+	// listeners may change Data and Vars, e.g. "view.before.admin.users.index".
+	EventBefore = "view.before."
+	// EventAfter is emitted with a *ViewEvent after the view was executed,
+	// listeners may rewrite Output, e.g. "view.after.admin.*".
+	EventAfter = "view.after."
+)
+
+// ViewEvent is the payload of the view events.
+type ViewEvent struct {
+	*View
+
+	// Output is the rendered view, empty before the view is executed.
+	Output []byte
+}
+
+// Inject inserts the html before the last marker of the output, e.g. a
+// banner before "</body>". It reports whether the marker was found.
+func (self *ViewEvent) Inject(marker, html string) bool {
+	var i = bytes.LastIndex(self.Output, []byte(marker))
+
+	if i < 0 {
+		return false
+	}
+
+	var output = make([]byte, 0, len(self.Output)+len(html))
+
+	output = append(output, self.Output[:i]...)
+	output = append(output, html...)
+	self.Output = append(output, self.Output[i:]...)
+
+	return true
+}
+
+// LegacyViewListener adapts a listener of view.after written for the
+// payload before ViewEvent, a *safemap.SafeMap with "name", "data",
+// "context" and "buf", the output which the listener may replace:
+//
+//	observer.On("view.after.home", template.LegacyViewListener(listener))
+//
+// Deprecated: listen to the *ViewEvent payload.
+func LegacyViewListener(listener event.Listener) event.Listener {
+	var callback = listener.Callback
+
+	listener.Callback = func(e *event.Event) error {
+		view, ok := e.Data.(*ViewEvent)
+
+		if !ok {
+			return callback(e)
+		}
+
+		args := safemap.NewSafeMap()
+		args.Set("name", view.Name)
+		args.Set("data", view.Data)
+		args.Set("context", view.Context)
+		args.Set("buf", view.Output)
+
+		if err := callback(&event.Event{Name: e.Name, Data: args}); err != nil {
+			return err
+		}
+
+		switch buf := args.Get("buf").(type) {
+		case []byte:
+			view.Output = buf
+		case string:
+			view.Output = []byte(buf)
+		}
+
+		return nil
+	}
+
+	return listener
+}
+
+// GetViewEventName returns the view name used in the event names, with "/"
+// replaced by ".".
+func GetViewEventName(name string) string {
+	var names = strings.Split(name, "/")
+
+	return strings.Join(names, ".")
+}
@@ -0,0 +1,76 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/dulumao/Guten-utils/os/event"
+	"github.com/dulumao/Guten-utils/safemap"
+	"github.com/labstack/echo"
+)
+
+func TestRenderer_Events(t *testing.T) {
+	defer observer.New()
+
+	observer.On(EventBefore+"admin.users.index", event.Listener{Callback: func(e *event.Event) error {
+		e.Data.(*ViewEvent).Data = map[string]interface{}{"name": "gopher"}
+		return nil
+	}})
+	observer.On(EventAfter+"admin.*", event.Listener{Callback: func(e *event.Event) error {
+		e.Data.(*ViewEvent).Inject("</body>", "<p>banner</p>")
+		return nil
+	}})
+
+	observer.On(EventAfter+"admin.users.index", LegacyViewListener(event.Listener{Callback: func(e *event.Event) error {
+		args := e.Data.(*safemap.SafeMap)
+		args.Set("buf", string(args.Get("buf").([]byte))+"!")
+		return nil
+	}}))
+
+	renderer := NewWithLoader(true, NewMemoryLoader(map[string]string{
+		"admin/users/index.jet": `<body>{{ .name }}</body>`,
+	}))
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "admin/users/index", nil, newTestContext(echo.New(), "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "<body>gopher<p>banner</p></body>!" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestRenderer_ComposerOrder(t *testing.T) {
+	defer observer.New()
+
+	var order []string
+
+	observer.On(EventBefore+"page", event.Listener{Priority: ComposerPriority - 1, Callback: func(e *event.Event) error {
+		order = append(order, "early")
+		return nil
+	}})
+	observer.On(EventBefore+"page", event.Listener{Callback: func(e *event.Event) error {
+		order = append(order, "listener:"+e.Data.(*ViewEvent).Vars["title"].String())
+		return nil
+	}})
+	Compose("page", func(view *View) {
+		order = append(order, "composer")
+		view.With("title", "composed")
+	})
+
+	renderer := NewWithLoader(true, NewMemoryLoader(map[string]string{"page.jet": `{{ title }}`}))
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "page", nil, newTestContext(echo.New(), "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(order, ",") != "early,composer,listener:composed" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
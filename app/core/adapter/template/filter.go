@@ -0,0 +1,295 @@
+package template
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// NonceKey is the context key of the CSP nonce of the request.
+const NonceKey = "csp_nonce"
+
+// IFilter post-processes the output of a render, after the view.after
+// listeners, so their output is filtered as well.
+type IFilter interface {
+	Filter(view *View, out []byte) ([]byte, error)
+}
+
+// FilterFunc adapts a function to IFilter.
+type FilterFunc func(view *View, out []byte) ([]byte, error)
+
+func (self FilterFunc) Filter(view *View, out []byte) ([]byte, error) {
+	return self(view, out)
+}
+
+// ISourceFilter is implemented by filters that also rewrite the source of
+// the templates when it is loaded, before it is parsed.
+type ISourceFilter interface {
+	FilterSource(name string, source []byte) []byte
+}
+
+// Use appends filters to the output chain, they run in order. Filters are
+// added when the application starts, before the renderer parses templates,
+// e.g. with Precompile.
+func (self *Renderer) Use(filters ...IFilter) {
+	self.filters = append(self.filters, filters...)
+
+	for _, filter := range filters {
+		if source, ok := filter.(ISourceFilter); ok {
+			self.loader.sources = append(self.loader.sources, source)
+		}
+	}
+}
+
+// filter runs the filters on HTML, views rendered with another Content-Type
+// or with NoFilters are kept as they are.
+func (self *Renderer) filter(view *View, out []byte) ([]byte, error) {
+	var err error
+
+	if view.NoFilters {
+		return out, nil
+	}
+
+	if view.Context != nil {
+		if contentType := view.Context.Response().Header().Get(echo.HeaderContentType); contentType != "" && !strings.HasPrefix(contentType, echo.MIMETextHTML) {
+			return out, nil
+		}
+	}
+
+	for _, filter := range self.filters {
+		if out, err = filter.Filter(view, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// CSPNonce returns the nonce of the request, created on the first call. It
+// is the cspNonce() function of the templates.
+func CSPNonce(ctx echo.Context) string {
+	if nonce, ok := ctx.Get(NonceKey).(string); ok {
+		return nonce
+	}
+
+	var b = make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	nonce := base64.StdEncoding.EncodeToString(b)
+	ctx.Set(NonceKey, nonce)
+
+	return nonce
+}
+
+var (
+	// script and style tags, whose quoted attributes may contain ">"
+	nonceTagPattern = regexp.MustCompile(`(?i)<(?:script|style)\b[^>"']*(?:(?:"[^"]*"|'[^']*')[^>"']*)*>`)
+	noncePattern    = regexp.MustCompile(`(?i)\snonce\s*=`)
+)
+
+// nonceAttribute is added to the tags of the templates.
+const nonceAttribute = ` nonce="{{ cspNonce() }}"`
+
+type nonceFilter struct {
+	policy string
+}
+
+// NonceFilter adds the nonce of the request to the script and style tags
+// without one. The tags of the template sources get nonce="{{ cspNonce() }}"
+// when they are loaded, so tags in the rendered data never get a nonce.
+// With a policy, e.g. "script-src 'self' 'nonce-{nonce}'", the
+// Content-Security-Policy header is set with the nonce. A page with a nonce
+// is not stored by the response cache.
+func NonceFilter(policy string) IFilter {
+	return &nonceFilter{policy: policy}
+}
+
+func (self *nonceFilter) Filter(view *View, out []byte) ([]byte, error) {
+	if view.Context != nil && self.policy != "" {
+		nonce := CSPNonce(view.Context)
+		view.Context.Response().Header().Set("Content-Security-Policy", strings.Replace(self.policy, "{nonce}", nonce, -1))
+	}
+
+	return out, nil
+}
+
+func (self *nonceFilter) FilterSource(name string, source []byte) []byte {
+	return nonceTagPattern.ReplaceAllFunc(source, func(tag []byte) []byte {
+		if noncePattern.Match(tag) {
+			return tag
+		}
+
+		// after "<script" or "<style"
+		var end = 1
+
+		for end < len(tag) && (tag[end]|0x20 >= 'a' && tag[end]|0x20 <= 'z') {
+			end++
+		}
+
+		return []byte(string(tag[:end]) + nonceAttribute + string(tag[end:]))
+	})
+}
+
+var (
+	stylesheetPattern = regexp.MustCompile(`(?i)<link\b[^>]*\brel\s*=\s*["']?stylesheet\b[^>]*>`)
+	scriptSrcPattern  = regexp.MustCompile(`(?i)<script\b[^>]*\bsrc\s*=\s*["']?([^"'\s>]+)[^>]*>`)
+	hrefPattern       = regexp.MustCompile(`(?i)\bhref\s*=\s*["']?([^"'\s>]+)`)
+	modulePattern     = regexp.MustCompile(`(?i)\btype\s*=\s*["']?module\b`)
+)
+
+// PreloadFilter sends a Link header preloading the stylesheets and scripts
+// of the page, at most limit of them, 0 for all. Proxies and CDNs turn the
+// header into 103 Early Hints.
+func PreloadFilter(limit int) IFilter {
+	return FilterFunc(func(view *View, out []byte) ([]byte, error) {
+		if view.Context == nil {
+			return out, nil
+		}
+
+		var header = view.Context.Response().Header()
+		var seen = make(map[string]bool)
+
+		add := func(url, as string) {
+			if seen[url] || strings.HasPrefix(url, "data:") || (limit > 0 && len(seen) >= limit) {
+				return
+			}
+
+			seen[url] = true
+
+			if as == "modulepreload" {
+				header.Add("Link", fmt.Sprintf("<%s>; rel=modulepreload", url))
+			} else {
+				header.Add("Link", fmt.Sprintf("<%s>; rel=preload; as=%s", url, as))
+			}
+		}
+
+		for _, tag := range stylesheetPattern.FindAll(out, -1) {
+			if href := hrefPattern.FindSubmatch(tag); href != nil {
+				add(string(href[1]), "style")
+			}
+		}
+
+		for _, match := range scriptSrcPattern.FindAllSubmatch(out, -1) {
+			if modulePattern.Match(match[0]) {
+				add(string(match[1]), "modulepreload")
+			} else {
+				add(string(match[1]), "script")
+			}
+		}
+
+		return out, nil
+	})
+}
+
+var (
+	// the content of these elements is kept as is
+	preservedPattern = regexp.MustCompile(`(?is)<pre\b.*?</pre\s*>|<textarea\b.*?</textarea\s*>|<script\b.*?</script\s*>|<style\b.*?</style\s*>`)
+	// comments and tags, whose quoted attribute values may contain ">"
+	tokenPattern = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z!][^>"']*(?:(?:"[^"]*"|'[^']*')[^>"']*)*>`)
+	// whitespace of a tag outside its quoted attribute values
+	tagSpacePattern = regexp.MustCompile(`"[^"]*"|'[^']*'|\s+`)
+	spacePattern    = regexp.MustCompile(`\s+`)
+
+	blockTags       = `html|head|body|title|meta|link|base|script|style|noscript|div|p|ul|ol|li|dl|dt|dd|table|thead|tbody|tfoot|tr|td|th|caption|colgroup|col|section|header|footer|nav|main|article|aside|figure|figcaption|form|fieldset|legend|h[1-6]|hr|br|blockquote|option|optgroup|select|!doctype`
+	blockTagPattern = regexp.MustCompile(`(?i)^</?(?:` + blockTags + `)\b`)
+)
+
+// MinifyHTML removes comments, collapses whitespace and removes it around
+// block elements. Conditional comments, quoted attribute values and the
+// content of pre, textarea, script and style are kept.
+func MinifyHTML() IFilter {
+	return FilterFunc(func(view *View, out []byte) ([]byte, error) {
+		return minifyHTML(out), nil
+	})
+}
+func minifyHTML(out []byte) []byte {
+	var minified = make([]byte, 0, len(out))
+	var last int
+	var afterBlock bool
+
+	for _, loc := range preservedPattern.FindAllIndex(out, -1) {
+		var text = minifyText(out[last:loc[0]])
+		var block = !bytes.HasPrefix(bytes.ToLower(out[loc[0]:loc[0]+9]), []byte("<textarea"))
+
+		// whitespace around pre, script and style is not shown
+		if afterBlock {
+			text = bytes.TrimLeft(text, " ")
+		}
+
+		if block {
+			text = bytes.TrimRight(text, " ")
+		}
+
+		minified = append(minified, text...)
+		minified = append(minified, out[loc[0]:loc[1]]...)
+		last, afterBlock = loc[1], block
+	}
+
+	var text = minifyText(out[last:])
+
+	if afterBlock {
+		text = bytes.TrimLeft(text, " ")
+	}
+
+	return bytes.TrimSpace(append(minified, text...))
+}
+
+func minifyText(text []byte) []byte {
+	var minified = make([]byte, 0, len(text))
+	var pending []byte
+	var last int
+	var afterBlock bool
+
+	for _, loc := range tokenPattern.FindAllIndex(text, -1) {
+		var token = text[loc[0]:loc[1]]
+
+		// the text around a removed comment is joined
+		pending = append(pending, text[last:loc[0]]...)
+		last = loc[1]
+
+		if bytes.HasPrefix(token, []byte("<!--")) {
+			if !bytes.HasPrefix(token, []byte("<!--[if")) && !bytes.HasPrefix(token, []byte("<!--<![endif]")) {
+				continue
+			}
+		} else {
+			token = tagSpacePattern.ReplaceAllFunc(token, func(match []byte) []byte {
+				if match[0] == '"' || match[0] == '\'' {
+					return match
+				}
+
+				return []byte(" ")
+			})
+		}
+
+		var block = blockTagPattern.Match(token)
+		var between = spacePattern.ReplaceAll(pending, []byte(" "))
+
+		if afterBlock {
+			between = bytes.TrimLeft(between, " ")
+		}
+
+		if block {
+			between = bytes.TrimRight(between, " ")
+		}
+
+		minified = append(minified, between...)
+		minified = append(minified, token...)
+		pending, afterBlock = pending[:0], block
+	}
+
+	var between = spacePattern.ReplaceAll(append(pending, text[last:]...), []byte(" "))
+
+	if afterBlock {
+		between = bytes.TrimLeft(between, " ")
+	}
+
+	return append(minified, between...)
+}
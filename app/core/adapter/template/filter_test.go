@@ -0,0 +1,119 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dulumao/Guten-framework/app/core/observer"
+	"github.com/labstack/echo"
+)
+
+func TestRenderer_Filters(t *testing.T) {
+	renderer := New(true, "testdata")
+	renderer.Use(
+		NonceFilter("script-src 'self' 'nonce-{nonce}'"),
+		PreloadFilter(0),
+		MinifyHTML(),
+	)
+
+	c := newTestContext(echo.New(), "")
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "layout.jet", map[string]string{"Title": "Home", "Name": "gopher"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := CSPNonce(c)
+	expected := `<!DOCTYPE html><html><head><link rel="stylesheet" href="/static/app.css">` +
+		`<script nonce="` + nonce + `" type="module" src="/static/app.js"></script>` +
+		`<style nonce="` + nonce + `">
+            body  { margin: 0 }
+        </style></head><body><h1>Home</h1><p title="gopher  >  Home">Hello <b>gopher</b> <i>!</i></p><pre>
+  keep   this
+        </pre>` +
+		`<script nonce="` + nonce + `">
+            var  nonce = "` + nonce + `";
+        </script></body></html>`
+
+	if buf.String() != expected {
+		t.Errorf("unexpected output\n%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	if csp := c.Response().Header().Get("Content-Security-Policy"); csp != "script-src 'self' 'nonce-"+nonce+"'" {
+		t.Errorf("Content-Security-Policy %q", csp)
+	}
+
+	links := c.Response().Header()["Link"]
+
+	if strings.Join(links, ", ") != "</static/app.css>; rel=preload; as=style, </static/app.js>; rel=modulepreload" {
+		t.Errorf("Link %q", links)
+	}
+
+	// only HTML is filtered
+	renderer.Use(FilterFunc(func(view *View, out []byte) ([]byte, error) {
+		return []byte("filtered"), nil
+	}))
+
+	c = newTestContext(echo.New(), "")
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	buf.Reset()
+
+	if err := renderer.Render(&buf, "layout.jet", map[string]string{"Title": "Home", "Name": "gopher"}, c); err != nil || buf.String() == "filtered" {
+		t.Errorf("expect text not to be filtered, got %q, %v", buf.String(), err)
+	}
+
+	Compose("layout.jet", func(view *View) {
+		view.NoFilters = true
+	})
+	defer observer.New()
+
+	buf.Reset()
+
+	if err := renderer.Render(&buf, "layout.jet", map[string]string{"Title": "Home", "Name": "gopher"}, newTestContext(echo.New(), "")); err != nil || buf.String() == "filtered" {
+		t.Errorf("expect views with NoFilters not to be filtered, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestNonceFilter_Source(t *testing.T) {
+	renderer := NewWithLoader(true, NewMemoryLoader(map[string]string{
+		"page.jet": `<script>a</script><STYLE media="x>y">b</STYLE><script nonce="own">c</script>{{ .Comment | raw }}<scripts>`,
+	}))
+	renderer.Use(NonceFilter(""))
+
+	c := newTestContext(echo.New(), "")
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "page", map[string]string{"Comment": "<script>evil()</script>"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := CSPNonce(c)
+	expected := `<script nonce="` + nonce + `">a</script><STYLE nonce="` + nonce + `" media="x>y">b</STYLE>` +
+		`<script nonce="own">c</script><script>evil()</script><scripts>`
+
+	if buf.String() != expected {
+		t.Errorf("unexpected output\n%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	if csp := c.Response().Header().Get("Content-Security-Policy"); csp != "" {
+		t.Errorf("expect no policy, got %q", csp)
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	for input, expected := range map[string]string{
+		"<div>\n  <span>a</span>\n  <span>b</span>\n</div>":  "<div><span>a</span> <span>b</span></div>",
+		"<!--[if IE]><p>old</p><![endif]--> <!-- x -->":      "<!--[if IE]><p>old</p><![endif]-->",
+		"<p>a</p>\n<textarea>  x  </textarea>\n<p>b</p>":     "<p>a</p><textarea>  x  </textarea><p>b</p>",
+		"text\n\n<textarea> x </textarea>\n  more":           "text <textarea> x </textarea> more",
+		"<div  title=\"a  >  b\"\n class='c  d'>  x  </div>": "<div title=\"a  >  b\" class='c  d'>x</div>",
+		"a <!-- x --> <input value=\"  <p> \">":              "a <input value=\"  <p> \">",
+	} {
+		if output := string(minifyHTML([]byte(input))); output != expected {
+			t.Errorf("minifyHTML(%q) = %q, expected %q", input, output, expected)
+		}
+	}
+}
@@ -2,13 +2,49 @@ package template
 
 import (
 	"errors"
+	"go/build"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
+// ILoader finds and opens the files of templates.
+type ILoader interface {
+	// Exists returns the file of the template name.
+	Exists(name string) (string, bool)
+	// Open opens a file returned by Exists.
+	Open(file string) (io.ReadCloser, error)
+	// List returns the names of all templates, those with Extensions.
+	List() []string
+}
+
+// IWatchableLoader is implemented by loaders whose files can change while
+// the application runs, see Renderer.Watch.
+type IWatchableLoader interface {
+	ILoader
+	// ModTimes returns the modification time of every file.
+	ModTimes() map[string]time.Time
+}
+
+// Loaders are searched after the template directories of env.toml, e.g.
+// templates compiled into the binary by the application or plugins.
+var Loaders []ILoader
+
+// isTemplate reports whether the file has one of the Extensions.
+func isTemplate(file string) bool {
+	for _, extension := range Extensions {
+		if strings.HasSuffix(file, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type OSFileSystemLoader struct {
 	dirs []string
 }
@@ -33,7 +69,9 @@ func (l *OSFileSystemLoader) Open(name string) (io.ReadCloser, error) {
 }
 
 // Exists checks if the template name exists by walking the list of template paths
-// returns string with the full path of the template and bool true if the template file was found
+// returns string with the full path of the template and bool true if the template file was found.
+// "name::path" templates are looked up in directories with a "{name}" placeholder, see Namespaces
+// for namespaces with their own directories and overrides.
 func (l *OSFileSystemLoader) Exists(name string) (string, bool) {
 	for i := 0; i < len(l.dirs); i++ {
 		var fileName string
@@ -48,31 +86,86 @@ func (l *OSFileSystemLoader) Exists(name string) (string, bool) {
 			}
 		}
 
-		if _, err := os.Stat(fileName); err == nil {
+		if info, err := os.Stat(fileName); err == nil && !info.IsDir() {
 			return fileName, true
 		}
 	}
 	return "", false
 }
 
+// List returns the templates of the directories, directories of namespaced
+// templates, those with "{name}", are skipped.
+func (l *OSFileSystemLoader) List() []string {
+	var names []string
+
+	for _, dir := range l.dirs {
+		if strings.Contains(dir, "{name}") {
+			continue
+		}
+
+		filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && isTemplate(file) {
+				name, _ := filepath.Rel(dir, file)
+				names = append(names, filepath.ToSlash(name))
+			}
+
+			return nil
+		})
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ModTimes returns the modification time of the files of the directories,
+// namespaced directories are walked up to the "{name}" placeholder.
+func (l *OSFileSystemLoader) ModTimes() map[string]time.Time {
+	var files = make(map[string]time.Time)
+
+	for _, dir := range l.dirs {
+		if i := strings.Index(dir, "{name}"); i >= 0 {
+			dir = dir[:i]
+		}
+
+		filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files[filepath.Clean(file)] = info.ModTime()
+			}
+
+			return nil
+		})
+	}
+
+	return files
+}
+
 // AddPath adds the path to the internal list of paths searched when loading templates.
 func (l *OSFileSystemLoader) AddPath(path string) {
 	l.dirs = append(l.dirs, path)
 }
 
-// AddGopathPath adds a path located in the GOPATH.
+// AddGopathPath adds the directory of a package path, found in the module
+// of the application or its dependencies, or in the GOPATH.
 // Example: l.AddGopathPath("github.com/CloudyKit/jet/example/views")
 func (l *OSFileSystemLoader) AddGopathPath(path string) {
+	// go/build asks the go command in module mode
+	if wd, err := os.Getwd(); err == nil {
+		if pkg, err := build.Import(path, wd, build.FindOnly); err == nil && pkg.Dir != "" {
+			l.AddPath(pkg.Dir)
+			return
+		}
+	}
+
 	paths := filepath.SplitList(os.Getenv("GOPATH"))
 	for i := 0; i < len(paths); i++ {
-		var err error
-		path, err = filepath.Abs(filepath.Join(paths[i], "src", path))
+		dir, err := filepath.Abs(filepath.Join(paths[i], "src", path))
 		if err != nil {
 			panic(errors.New("Can't add this path err: " + err.Error()))
 		}
 
-		if fstats, err := os.Stat(path); os.IsNotExist(err) == false && fstats.IsDir() {
-			l.AddPath(path)
+		if fstats, err := os.Stat(dir); os.IsNotExist(err) == false && fstats.IsDir() {
+			l.AddPath(dir)
 			return
 		}
 	}
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChainLoader looks up templates in its loaders in order, so the templates
+// of the application overlay the defaults of the framework and plugins:
+//
+//	NewChainLoader(NewOSFileSystemLoader("web/views"), NewFileSystemLoader(assets, "views"))
+type ChainLoader struct {
+	loaders []ILoader
+
+	// the loader of every file returned by Exists
+	mutex sync.RWMutex
+	files map[string]ILoader
+}
+
+func NewChainLoader(loaders ...ILoader) *ChainLoader {
+	return &ChainLoader{loaders: loaders, files: make(map[string]ILoader)}
+}
+
+// Add appends a loader, its templates are used when no loader before has
+// them.
+func (self *ChainLoader) Add(loader ILoader) {
+	self.mutex.Lock()
+	self.loaders = append(self.loaders, loader)
+	self.mutex.Unlock()
+}
+
+func (self *ChainLoader) Exists(name string) (string, bool) {
+	self.mutex.RLock()
+	var loaders = self.loaders
+	self.mutex.RUnlock()
+
+	for _, loader := range loaders {
+		if file, ok := loader.Exists(name); ok {
+			self.mutex.Lock()
+			self.files[file] = loader
+			self.mutex.Unlock()
+
+			return file, true
+		}
+	}
+
+	return "", false
+}
+
+func (self *ChainLoader) Open(file string) (io.ReadCloser, error) {
+	self.mutex.RLock()
+	loader, ok := self.files[file]
+	self.mutex.RUnlock()
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return loader.Open(file)
+}
+
+// List returns the templates of all loaders, each name once.
+func (self *ChainLoader) List() []string {
+	self.mutex.RLock()
+	var loaders = self.loaders
+	self.mutex.RUnlock()
+
+	var seen = make(map[string]bool)
+	var names []string
+
+	for _, loader := range loaders {
+		for _, name := range loader.List() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ModTimes returns the files of the loaders that can be watched.
+func (self *ChainLoader) ModTimes() map[string]time.Time {
+	self.mutex.RLock()
+	var loaders = self.loaders
+	self.mutex.RUnlock()
+
+	var modTimes = make(map[string]time.Time)
+
+	for _, loader := range loaders {
+		if watchable, ok := loader.(IWatchableLoader); ok {
+			for file, modTime := range watchable.ModTimes() {
+				modTimes[file] = modTime
+			}
+		}
+	}
+
+	return modTimes
+}
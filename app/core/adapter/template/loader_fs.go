@@ -0,0 +1,83 @@
+package template
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FileSystemLoader loads templates from a http.FileSystem, e.g. templates
+// compiled into the binary with vfsgen or statik, or http.Dir.
+type FileSystemLoader struct {
+	fs   http.FileSystem
+	root string
+}
+
+// NewFileSystemLoader returns a loader for the templates below root of fs.
+func NewFileSystemLoader(fs http.FileSystem, root string) *FileSystemLoader {
+	return &FileSystemLoader{fs: fs, root: path.Join("/", root)}
+}
+
+func (self *FileSystemLoader) Exists(name string) (string, bool) {
+	var file = path.Join(self.root, name)
+
+	f, err := self.fs.Open(file)
+
+	if err != nil {
+		return "", false
+	}
+
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		return "", false
+	}
+
+	return file, true
+}
+
+func (self *FileSystemLoader) Open(file string) (io.ReadCloser, error) {
+	return self.fs.Open(file)
+}
+
+func (self *FileSystemLoader) List() []string {
+	var names []string
+
+	self.walk(self.root, func(file string) {
+		if isTemplate(file) {
+			names = append(names, strings.TrimPrefix(strings.TrimPrefix(file, self.root), "/"))
+		}
+	})
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (self *FileSystemLoader) walk(dir string, fn func(file string)) {
+	f, err := self.fs.Open(dir)
+
+	if err != nil {
+		return
+	}
+
+	infos, err := f.Readdir(-1)
+	f.Close()
+
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		var file = path.Join(dir, info.Name())
+
+		if info.IsDir() {
+			self.walk(file, fn)
+		} else if info.Mode()&os.ModeType == 0 {
+			fn(file)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryLoader keeps templates in memory, for tests and generated
+// templates. Templates can be changed while rendering, a watching renderer
+// then parses them again.
+type MemoryLoader struct {
+	mutex     sync.RWMutex
+	templates map[string]string
+	modTimes  map[string]time.Time
+}
+
+func NewMemoryLoader(templates map[string]string) *MemoryLoader {
+	var self = &MemoryLoader{
+		templates: make(map[string]string),
+		modTimes:  make(map[string]time.Time),
+	}
+
+	for name, content := range templates {
+		self.Set(name, content)
+	}
+
+	return self
+}
+
+// Set adds or replaces the template.
+func (self *MemoryLoader) Set(name, content string) {
+	name = strings.TrimPrefix(name, "/")
+
+	self.mutex.Lock()
+	self.templates[name] = content
+	self.modTimes[name] = time.Now()
+	self.mutex.Unlock()
+}
+
+// Delete removes the template.
+func (self *MemoryLoader) Delete(name string) {
+	name = strings.TrimPrefix(name, "/")
+
+	self.mutex.Lock()
+	delete(self.templates, name)
+	delete(self.modTimes, name)
+	self.mutex.Unlock()
+}
+
+func (self *MemoryLoader) Exists(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "/")
+
+	self.mutex.RLock()
+	_, ok := self.templates[name]
+	self.mutex.RUnlock()
+
+	return name, ok
+}
+
+func (self *MemoryLoader) Open(file string) (io.ReadCloser, error) {
+	self.mutex.RLock()
+	content, ok := self.templates[file]
+	self.mutex.RUnlock()
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func (self *MemoryLoader) List() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var names []string
+
+	for name := range self.templates {
+		if isTemplate(name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (self *MemoryLoader) ModTimes() map[string]time.Time {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var modTimes = make(map[string]time.Time, len(self.modTimes))
+
+	for name, modTime := range self.modTimes {
+		modTimes[name] = modTime
+	}
+
+	return modTimes
+}
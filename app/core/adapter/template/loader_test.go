@@ -0,0 +1,46 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestChainLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "views", "auth"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "views", "layout.jet"), []byte(`default {{ yield body() }}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "views", "auth", "login.jet"), []byte(`{{ extends "/layout.jet" }}{{ block body() }}login{{ end }}`), 0644)
+
+	app := NewMemoryLoader(map[string]string{
+		"layout.jet": `app {{ yield body() }}`,
+	})
+	loader := NewChainLoader(app, NewFileSystemLoader(http.Dir(dir), "views"))
+
+	if names := loader.List(); !reflect.DeepEqual(names, []string{"auth/login.jet", "layout.jet"}) {
+		t.Errorf("unexpected templates %v", names)
+	}
+
+	var buf bytes.Buffer
+
+	if err := NewWithLoader(true, loader).Render(&buf, "auth/login", nil, newTestContext(echo.New(), "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "app login" {
+		t.Errorf("expect the layout of the app over the default, got %q", buf.String())
+	}
+}
@@ -0,0 +1,261 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NamespaceSeparator separates the namespace from the template name, e.g.
+// "blog::posts/show".
+const NamespaceSeparator = "::"
+
+var ErrUnknownNamespace = errors.New("template: unknown namespace")
+
+type namespace struct {
+	loaders   []ILoader
+	overrides []ILoader
+}
+
+// NamespaceRegistry loads the templates of plugins by namespace. The
+// overrides of a namespace, e.g. the theme of the application, are looked
+// up before the templates of the plugin.
+type NamespaceRegistry struct {
+	mutex      sync.RWMutex
+	namespaces map[string]*namespace
+
+	// the loader of every file returned by Exists
+	files map[string]ILoader
+	// namespaces of templates no loader of a renderer had
+	unknown map[string]bool
+}
+
+// Namespaces is the registry of the renderer created by core.New.
+var Namespaces = NewNamespaceRegistry()
+
+func NewNamespaceRegistry() *NamespaceRegistry {
+	return &NamespaceRegistry{
+		namespaces: make(map[string]*namespace),
+		files:      make(map[string]ILoader),
+		unknown:    make(map[string]bool),
+	}
+}
+
+// SplitNamespace splits "blog::posts/show" into "blog" and "posts/show",
+// names without a namespace return an empty namespace.
+func SplitNamespace(name string) (string, string) {
+	name = strings.TrimPrefix(name, "/")
+
+	if i := strings.Index(name, NamespaceSeparator); i > 0 {
+		return name[:i], name[i+len(NamespaceSeparator):]
+	}
+
+	return "", name
+}
+
+// Register adds loaders to the namespace, the first registration creates it.
+func (self *NamespaceRegistry) Register(name string, loaders ...ILoader) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.namespace(name).loaders = append(self.namespace(name).loaders, loaders...)
+}
+
+// RegisterDirs adds template directories to the namespace.
+func (self *NamespaceRegistry) RegisterDirs(name string, dirs ...string) {
+	self.Register(name, NewOSFileSystemLoader(dirs...))
+}
+
+// Override adds loaders whose templates replace the templates of the
+// namespace with the same name, later overrides have precedence.
+func (self *NamespaceRegistry) Override(name string, loaders ...ILoader) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.namespace(name).overrides = append(append([]ILoader{}, loaders...), self.namespace(name).overrides...)
+}
+
+func (self *NamespaceRegistry) namespace(name string) *namespace {
+	ns, ok := self.namespaces[name]
+
+	if !ok {
+		delete(self.unknown, name)
+		ns = new(namespace)
+		self.namespaces[name] = ns
+	}
+
+	return ns
+}
+
+// Has reports whether the namespace was registered.
+func (self *NamespaceRegistry) Has(name string) bool {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	_, ok := self.namespaces[name]
+
+	return ok
+}
+
+// markUnknown records a namespace that is not registered, a renderer
+// failed to load a template of it.
+func (self *NamespaceRegistry) markUnknown(name string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.namespaces[name]; !ok {
+		self.unknown[name] = true
+	}
+}
+
+// Unknown returns the namespaces of the templates that could not be loaded
+// because the namespace was not registered.
+func (self *NamespaceRegistry) Unknown() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var names = make([]string, 0, len(self.unknown))
+
+	for name := range self.unknown {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Names returns the registered namespaces.
+func (self *NamespaceRegistry) Names() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var names = make([]string, 0, len(self.namespaces))
+
+	for name := range self.namespaces {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Templates returns the templates of the namespace without the namespace,
+// overridden templates once.
+func (self *NamespaceRegistry) Templates(name string) ([]string, error) {
+	loaders, ok := self.loaders(name)
+
+	if !ok {
+		return nil, fmt.Errorf("%v %q", ErrUnknownNamespace, name)
+	}
+
+	var seen = make(map[string]bool)
+	var names []string
+
+	for _, loader := range loaders {
+		for _, template := range loader.List() {
+			if !seen[template] {
+				seen[template] = true
+				names = append(names, template)
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// loaders returns the overrides and loaders of the namespace in lookup order.
+func (self *NamespaceRegistry) loaders(name string) ([]ILoader, bool) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	ns, ok := self.namespaces[name]
+
+	if !ok {
+		return nil, false
+	}
+
+	return append(append([]ILoader{}, ns.overrides...), ns.loaders...), true
+}
+
+func (self *NamespaceRegistry) Exists(name string) (string, bool) {
+	ns, template := SplitNamespace(name)
+
+	if ns == "" {
+		return "", false
+	}
+
+	loaders, ok := self.loaders(ns)
+
+	// other loaders of the chain may have it, e.g. "{name}" templates of
+	// plugins in the template directories
+	if !ok {
+		return "", false
+	}
+
+	for _, loader := range loaders {
+		if file, ok := loader.Exists(template); ok {
+			self.mutex.Lock()
+			self.files[file] = loader
+			self.mutex.Unlock()
+
+			return file, true
+		}
+	}
+
+	return "", false
+}
+
+func (self *NamespaceRegistry) Open(file string) (io.ReadCloser, error) {
+	self.mutex.RLock()
+	loader, ok := self.files[file]
+	self.mutex.RUnlock()
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return loader.Open(file)
+}
+
+// List returns the templates of all namespaces with their namespace.
+func (self *NamespaceRegistry) List() []string {
+	var names []string
+
+	for _, ns := range self.Names() {
+		templates, _ := self.Templates(ns)
+
+		for _, template := range templates {
+			names = append(names, ns+NamespaceSeparator+template)
+		}
+	}
+
+	return names
+}
+
+// ModTimes returns the files of the loaders that can be watched.
+func (self *NamespaceRegistry) ModTimes() map[string]time.Time {
+	var modTimes = make(map[string]time.Time)
+
+	for _, ns := range self.Names() {
+		loaders, _ := self.loaders(ns)
+
+		for _, loader := range loaders {
+			if watchable, ok := loader.(IWatchableLoader); ok {
+				for file, modTime := range watchable.ModTimes() {
+					modTimes[file] = modTime
+				}
+			}
+		}
+	}
+
+	return modTimes
+}
@@ -0,0 +1,96 @@
+package template
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestNamespaceRegistry(t *testing.T) {
+	namespaces := Namespaces
+	Namespaces = NewNamespaceRegistry()
+	defer func() { Namespaces = namespaces }()
+
+	Namespaces.Register("blog", NewMemoryLoader(map[string]string{
+		"layout.jet":     `[{{ yield body() }}]`,
+		"posts/show.jet": `{{ extends "blog::layout.jet" }}{{ block body() }}{{ include "blog::posts/meta.jet" }}{{ end }}`,
+		"posts/meta.jet": `plugin`,
+	}))
+	Namespaces.Override("blog", NewMemoryLoader(map[string]string{
+		"posts/meta.jet": `theme`,
+	}))
+
+	if templates, _ := Namespaces.Templates("blog"); !reflect.DeepEqual(templates, []string{"layout.jet", "posts/meta.jet", "posts/show.jet"}) {
+		t.Errorf("unexpected templates %v", templates)
+	}
+
+	if _, err := Namespaces.Templates("shop"); err == nil {
+		t.Error("expect an error for an unknown namespace")
+	}
+
+	renderer := NewWithLoader(true, NewChainLoader(NewMemoryLoader(nil), Namespaces))
+	c := newTestContext(echo.New(), "")
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "blog::posts/show", nil, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "[theme]" {
+		t.Errorf("expect the overridden template, got %q", buf.String())
+	}
+
+	err := renderer.Render(&buf, "shop::cart", nil, c)
+
+	if templateErr, ok := err.(*TemplateError); !ok || templateErr.Err != ErrUnknownNamespace {
+		t.Errorf("expect ErrUnknownNamespace, got %v", err)
+	}
+
+	renderer = NewWithLoader(true, NewChainLoader(Namespaces, NewMemoryLoader(map[string]string{
+		"page.jet": `{{ include "forum::thread.jet" }}`,
+	})))
+
+	err = renderer.Render(&buf, "page", nil, c)
+
+	if templateErr, ok := err.(*TemplateError); !ok || templateErr.Err != ErrUnknownNamespace || templateErr.Name != "page.jet" {
+		t.Errorf("expect ErrUnknownNamespace of the included template, got %v", err)
+	}
+
+	if unknown := Namespaces.Unknown(); !reflect.DeepEqual(unknown, []string{"forum", "shop"}) {
+		t.Errorf("expect the unknown namespaces to be recorded, got %v", unknown)
+	}
+}
+
+func TestNamespaceRegistry_Errors(t *testing.T) {
+	registry := NewNamespaceRegistry()
+	registry.Register("blog", NewMemoryLoader(map[string]string{
+		"broken.jet": `{{ yield missing() }}`,
+	}))
+
+	// "{name}" templates of plugins are found in the template directories
+	renderer := NewWithLoader(true, NewChainLoader(registry, NewMemoryLoader(map[string]string{
+		"legacy::page.jet": `{{ yield missing() }}`,
+	})))
+	c := newTestContext(echo.New(), "")
+
+	var buf bytes.Buffer
+
+	if err := renderer.Render(&buf, "log::page", nil, c); err.(*TemplateError).Err != ErrUnknownNamespace {
+		t.Errorf("expect ErrUnknownNamespace, got %v", err)
+	}
+
+	for _, name := range []string{"legacy::page", "blog::broken"} {
+		err := renderer.Render(&buf, name, nil, c)
+
+		if templateErr, ok := err.(*TemplateError); !ok || templateErr.Err == ErrUnknownNamespace || templateErr.NotFound {
+			t.Errorf("%s: expect the error of the template, got %v", name, err)
+		}
+	}
+
+	if unknown := registry.Unknown(); !reflect.DeepEqual(unknown, []string{"log"}) {
+		t.Errorf("expect only log to be unknown, got %v", unknown)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/CloudyKit/jet"
+	"github.com/dulumao/Guten-framework/app/core/adapter/asset"
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
+	"github.com/dulumao/Guten-framework/app/core/adapter/gate"
 	"github.com/dulumao/Guten-framework/app/core/adapter/i18n"
 	"github.com/dulumao/Guten-framework/app/core/adapter/session"
 	"github.com/dulumao/Guten-framework/app/core/env"
@@ -12,49 +15,74 @@ import (
 	"github.com/dulumao/Guten-utils/conv"
 	"github.com/dulumao/Guten-utils/dump"
 	"github.com/dulumao/Guten-utils/file"
-	"github.com/dulumao/Guten-utils/safemap"
 	"github.com/gookit/validate"
 	"github.com/labstack/echo"
 	"html/template"
 	"io"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 模板注册
 type Renderer struct {
+	// Cached keeps the parsed templates, otherwise they are parsed on
+	// every render unless the renderer watches the template directories.
 	Cached bool
 	Engine *jet.Set
+
+	// the functions of view.Funcs, a *viewFuncs
+	funcs atomic.Value
+
+	loader    *recordingLoader
+	tmx       sync.RWMutex
+	templates map[string]*compiled
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	filters []IFilter
 }
 
 func New(cached bool, dirs ...string) *Renderer {
-	return &Renderer{
-		Cached: false,
+	return NewWithLoader(cached, NewOSFileSystemLoader(dirs...))
+}
+
+// NewWithLoader returns a renderer for the templates of the loader, e.g. a
+// ChainLoader over the template directories and embedded templates.
+func NewWithLoader(cached bool, loader ILoader) *Renderer {
+	var recorder = &recordingLoader{ILoader: loader}
+	var self = &Renderer{
+		Cached: cached,
 		// Engine: jet.NewHTMLSet(dirs...),
-		Engine: NewSetLoader(template.HTMLEscape, dirs...),
+		Engine:    jet.NewSetLoader(template.HTMLEscape, recorder),
+		loader:    recorder,
+		templates: make(map[string]*compiled),
 	}
+
+	self.Engine.SetDevelopmentMode(!self.Cached)
+	self.addGlobals()
+	self.addViewFuncs()
+
+	return self
 }
 
 func NewSetLoader(escapee jet.SafeWriter, dirs ...string) *jet.Set {
 	return jet.NewSetLoader(escapee, &OSFileSystemLoader{dirs: dirs})
 }
 
-func (self *Renderer) Render(out io.Writer, name string, data interface{}, ctx echo.Context) error {
-	self.Engine.SetDevelopmentMode(!self.Cached)
-
+// addGlobals registers the functions that do not depend on the request,
+// they are shared by all renders.
+func (self *Renderer) addGlobals() {
 	self.Engine.AddGlobal("isLast", func(i, size int) bool { return i == size-1 })
 	self.Engine.AddGlobal("isNotLast", func(i, size int) bool { return i != size-1 })
-	self.Engine.AddGlobal("route", ctx.Echo().Reverse)
 	self.Engine.AddGlobal("printf", fmt.Sprintf)
+	self.Engine.AddGlobal("asset", asset.URL)
 	self.Engine.AddGlobal("isNil", func(v interface{}) bool {
 		return v == nil
 	})
 	self.Engine.AddGlobal("isNilTime", func(v *time.Time) bool {
 		return v == nil
 	})
-	self.Engine.AddGlobal("getCsrf", func() string {
-		return conv.String(ctx.Get("csrf"))
-	})
 	self.Engine.AddGlobal("isEqual", func(v1 interface{}, v2 interface{}) bool {
 		if v1 == v2 {
 			return true
@@ -62,20 +90,6 @@ func (self *Renderer) Render(out io.Writer, name string, data interface{}, ctx e
 
 		return false
 	})
-	self.Engine.AddGlobal("session", func(key string) interface{} {
-		sess := session.Default(ctx)
-		data := sess.Get(key)
-		sess.Save()
-
-		return data
-	})
-	self.Engine.AddGlobal("flash", func(key string) []interface{} {
-		sess := session.Default(ctx)
-		data := sess.Flashes(key)
-		sess.Save()
-
-		return data
-	})
 	// jet has `unsafe` func
 	// self.Engine.AddGlobal("unescaped", func(x string) interface{} {
 	// 	return template.HTML(x)
@@ -89,142 +103,199 @@ func (self *Renderer) Render(out io.Writer, name string, data interface{}, ctx e
 	self.Engine.AddGlobal("dump2", func(i ...interface{}) {
 		dump.DD2(i...)
 	})
-	self.Engine.AddGlobal("HasValidError", func(key string) bool {
-		var errs = ctx.Get("errors")
+	self.Engine.AddGlobal("Tr", func(lang, format string, args ...interface{}) string {
+		// return i18n.Tr("en-US", "demo.name","matt")
+		return i18n.Tr(lang, format, args...)
+	})
+}
 
-		if validErrors, can := errs.(validate.Errors); can {
-			validResult := validErrors.All()
+// viewFuncs is a copy of view.Funcs at one version.
+type viewFuncs struct {
+	version int64
+	items   map[string]interface{}
+}
 
-			if _, ok := validResult[key]; ok {
-				return true
-			}
+// viewFuncs returns the functions of view.Funcs. They are usually added
+// while the application boots, so they are only copied again after
+// view.Funcs changed. They are variables of each render, the globals of
+// the engine are read by running templates and must not change.
+func (self *Renderer) viewFuncs() map[string]interface{} {
+	var version = view.Funcs.Version()
+
+	if funcs, ok := self.funcs.Load().(*viewFuncs); ok && funcs.version == version {
+		return funcs.items
+	}
+
+	var funcs = &viewFuncs{version: version, items: make(map[string]interface{})}
+
+	for k, v := range view.Funcs.Items() {
+		funcs.items[conv.String(k)] = v
+	}
+
+	self.funcs.Store(funcs)
+
+	return funcs.items
+}
+
+// CSRFReadKey is set in the context once the csrf token was read with
+// CSRFToken, the response cache does not store pages showing it.
+const CSRFReadKey = "csrf_read"
+
+// CSRFToken returns the csrf token of the request and marks it read. It is
+// the getCsrf() function of the templates, handlers sending the token
+// themselves use it as well.
+func CSRFToken(ctx echo.Context) string {
+	ctx.Set(CSRFReadKey, true)
+
+	return conv.String(ctx.Get("csrf"))
+}
+
+// requestVars returns the variables of one render, the helpers that need the
+// request. Variables take precedence over the globals of the engine.
+func requestVars(ctx echo.Context) jet.VarMap {
+	var vars = make(jet.VarMap, 20)
+
+	vars.Set("context", ctx)
+	vars.Set("env", env.Value)
+	vars.Set("route", ctx.Echo().Reverse)
+	vars.Set("getCsrf", func() string {
+		return CSRFToken(ctx)
+	})
+	vars.Set("session", func(key string) interface{} {
+		sess := session.Default(ctx)
+		data := sess.Get(key)
+		sess.Save()
+
+		return data
+	})
+	vars.Set("flash", func(key string) []interface{} {
+		sess := session.Default(ctx)
+		data := sess.Flashes(key)
+		sess.Save()
+
+		return data
+	})
+	vars.Set("HasValidError", func(key string) bool {
+		if validErrors, can := ctx.Get("errors").(validate.Errors); can {
+			_, ok := validErrors.All()[key]
+
+			return ok
 		}
 
 		return false
 	})
-	self.Engine.AddGlobal("GetValidError", func(key string) string {
-		var errs = ctx.Get("errors")
-
-		if validErrors, can := errs.(validate.Errors); can {
+	vars.Set("GetValidError", func(key string) string {
+		if validErrors, can := ctx.Get("errors").(validate.Errors); can {
 			return validErrors.Get(key)
 		}
 
 		return ""
 	})
-	self.Engine.AddGlobal("GetValidField", func(key string) []string {
-		var errs = ctx.Get("errors")
-
-		if validErrors, can := errs.(validate.Errors); can {
+	vars.Set("GetValidField", func(key string) []string {
+		if validErrors, can := ctx.Get("errors").(validate.Errors); can {
 			return validErrors.Field(key)
 		}
 
 		return []string{}
 	})
-	self.Engine.AddGlobal("GetValidAll", func(key string) map[string][]string {
-		var errs = ctx.Get("errors")
-
-		if validErrors, can := errs.(validate.Errors); can {
+	vars.Set("GetValidAll", func(key string) map[string][]string {
+		if validErrors, can := ctx.Get("errors").(validate.Errors); can {
 			return validErrors.All()
 		}
 
 		return map[string][]string{}
 	})
-	self.Engine.AddGlobal("GetValidIsEmpty", func(key string) bool {
-		var errs = ctx.Get("errors")
-
-		if validErrors, can := errs.(validate.Errors); can {
+	vars.Set("GetValidIsEmpty", func(key string) bool {
+		if validErrors, can := ctx.Get("errors").(validate.Errors); can {
 			return validErrors.Empty()
 		}
 
 		return true
 	})
-	self.Engine.AddGlobal("GetValidOneError", func(key string) string {
-		var errs = ctx.Get("errors")
-
-		if validErrors, can := errs.(validate.Errors); can {
-			validErrors.One()
+	vars.Set("GetValidOneError", func(key string) string {
+		if validErrors, can := ctx.Get("errors").(validate.Errors); can {
+			return validErrors.One()
 		}
 
 		return ""
 	})
-
-	self.Engine.AddGlobal("Tr", func(lang, format string, args ...interface{}) string {
-		// return i18n.Tr("en-US", "demo.name","matt")
-		return i18n.Tr(lang, format, args...)
+	vars.Set("lockoutSeconds", func() int {
+		return conv.Int(ctx.Get(auth.LockoutKey))
+	})
+	vars.Set("can", func(ability string, args ...interface{}) bool {
+		return gate.Default(ctx).Allows(ability, args...)
+	})
+	vars.Set("cspNonce", func() string {
+		return CSPNonce(ctx)
 	})
-	// self.Engine.AddGlobal("HasValidError", func(key string) bool {
-	// 	var errs = ctx.Get("errors")
-	//
-	// 	if validErrors, can := errs.(error); can {
-	// 		validResult := validation.GetErrorFields(validErrors, nil)
-	//
-	// 		if _, ok := validResult[key]; ok {
-	// 			return true
-	// 		}
-	// 	}
-	//
-	// 	return false
-	// })
-	// self.Engine.AddGlobal("GetValidError", func(key string) string {
-	// 	var errs = ctx.Get("errors")
-	// 	// uni := v.GetTranslator("zh_Hans_CN")
-	// 	// uni := v.GetTranslator("en_US")
-	// 	// validResult := validation.GetErrorFields(err, uni)
-	//
-	// 	if validErrors, can := errs.(error); can {
-	// 		validResult := validation.GetErrorFields(validErrors, nil)
-	//
-	// 		if _, ok := validResult[key]; ok {
-	// 			return validResult[key]["transText"]
-	// 		}
-	// 	}
-	//
-	// 	return ""
-	// })
 
-	for k, v := range view.Funcs.Items() {
-		self.Engine.AddGlobal(conv.String(k), v)
-	}
+	return vars
+}
 
-	t, err := self.Engine.GetTemplate(name)
+// Render renders the view, errors of the templates are returned as
+// *TemplateError.
+func (self *Renderer) Render(out io.Writer, name string, data interface{}, ctx echo.Context) error {
+	t, err := self.template(name)
 
 	if err != nil {
-		panic(err)
+		return self.templateError(name, err)
 	}
 
-	vars := make(jet.VarMap)
-	vars.Set("context", ctx)
-	vars.Set("env", env.Value)
+	vars := requestVars(ctx)
+
+	// the request helpers take precedence
+	for key, fn := range self.viewFuncs() {
+		if _, ok := vars[key]; !ok {
+			vars.Set(key, fn)
+		}
+	}
+
+	state := newViewState(self, vars)
+	view := &View{Name: name, Context: ctx, Data: data, Vars: vars}
+
+	if err = observer.Emit(EventBefore+GetViewEventName(name), &ViewEvent{View: view}); err != nil {
+		return err
+	}
 
 	buf := new(bytes.Buffer)
 
-	// if err = t.Execute(out, vars, data); err != nil {
-	// 	panic(err)
-	// }
-	//
-	if err = t.Execute(buf, vars, data); err != nil {
-		panic(err)
+	if err = self.execute(t, buf, view.Vars, view.Data); err == nil {
+		err = state.close()
+	}
+
+	if err != nil {
+		return self.templateError(name, err)
 	}
 
-	eventArgs := safemap.NewSafeMap()
-	eventArgs.Set("name", name)
-	eventArgs.Set("data", data)
-	eventArgs.Set("context", ctx)
-	eventArgs.Set("buf", buf.Bytes())
+	event := &ViewEvent{View: view, Output: state.fillStacks(buf.Bytes())}
+
+	if err = observer.Emit(EventAfter+GetViewEventName(name), event); err != nil {
+		return err
+	}
 
-	observer.Dispatcher.Emit("view.after."+GetViewEventName(name), eventArgs)
+	output, err := self.filter(view, event.Output)
 
-	if buf, ok := eventArgs.Get("buf").([]byte); ok {
-		out.Write(buf)
-	} else if buf, ok := eventArgs.Get("buf").(string); ok {
-		out.Write([]byte(buf))
+	if err != nil {
+		return err
 	}
 
+	_, err = out.Write(output)
+
 	return err
 }
 
-func GetViewEventName(name string) string {
-	var names = strings.Split(name, "/")
+// execute also returns the panics of functions called by the template,
+// jet only turns its own errors into an error.
+func (self *Renderer) execute(t *jet.Template, out io.Writer, vars jet.VarMap, data interface{}) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			var ok bool
+
+			if err, ok = recovered.(error); !ok {
+				err = fmt.Errorf("%v", recovered)
+			}
+		}
+	}()
 
-	return strings.Join(names, ".")
+	return t.Execute(out, vars, data)
 }
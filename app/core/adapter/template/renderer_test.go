@@ -0,0 +1,243 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/helpers/view"
+	"github.com/labstack/echo"
+)
+
+type page struct {
+	Names []string
+}
+
+func newTestContext(app *echo.Echo, csrf string) echo.Context {
+	c := app.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.Set("csrf", csrf)
+
+	return c
+}
+
+func TestRenderer_Render(t *testing.T) {
+	renderer := New(false, "testdata")
+	app := echo.New()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(csrf string) {
+			defer wg.Done()
+
+			var buf bytes.Buffer
+
+			if err := renderer.Render(&buf, "page.jet", page{Names: []string{"a", "b"}}, newTestContext(app, csrf)); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !strings.Contains(buf.String(), `value="`+csrf+`"`) || !strings.Contains(buf.String(), "a, b") {
+				t.Errorf("expect the csrf token %s of the request in\n%s", csrf, buf.String())
+			}
+		}("token-" + strconv.Itoa(i))
+	}
+
+	wg.Wait()
+}
+
+// TestRenderer_RequestHelpers renders a second request while the first one
+// is paused, the first must still see its own helpers.
+func TestRenderer_RequestHelpers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "paused.jet"), []byte(`{{ pause() }}{{ getCsrf() }}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "plain.jet"), []byte(`{{ getCsrf() }} {{ greet() }}`), 0644)
+
+	var paused = make(chan struct{})
+	var resume = make(chan struct{})
+
+	view.Funcs.Set("pause", func() string {
+		close(paused)
+		<-resume
+
+		return ""
+	})
+	view.Funcs.Set("greet", func() string { return "hello" })
+	defer view.Funcs.BatchRemove([]string{"pause", "greet"})
+
+	renderer := New(false, dir)
+	app := echo.New()
+
+	var first bytes.Buffer
+	var done = make(chan error)
+
+	go func() {
+		done <- renderer.Render(&first, "paused.jet", nil, newTestContext(app, "first"))
+	}()
+
+	<-paused
+
+	// replacing a function keeps the number of functions
+	view.Funcs.Set("greet", func() string { return "hi" })
+
+	var second bytes.Buffer
+
+	if err := renderer.Render(&second, "plain.jet", nil, newTestContext(app, "second")); err != nil {
+		t.Fatal(err)
+	}
+
+	close(resume)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if first.String() != "first" || second.String() != "second hi" {
+		t.Errorf("expect each request to get its own helpers, got %q and %q", first.String(), second.String())
+	}
+}
+
+func TestRenderer_Precompile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "good.jet"), []byte(`{{ "ok" }}`), 0644)
+
+	if err := New(true, dir).Precompile(); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "bad.jet"), []byte(`{{ if }}`), 0644)
+
+	if err := New(true, dir).Precompile(); err == nil || !strings.Contains(err.Error(), "bad.jet") {
+		t.Errorf("expect the syntax error of bad.jet, got %v", err)
+	}
+}
+
+func TestRenderer_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("layout.jet", `[{{ yield body() }}]`)
+	write("page.jet", `{{ extends "layout.jet" }}{{ block body() }}page{{ end }}`)
+	write("other.jet", `other`)
+
+	renderer := New(false, dir)
+	renderer.Watch(10 * time.Millisecond)
+	defer renderer.Close()
+
+	page, _ := renderer.template("page")
+	other, _ := renderer.template("other")
+
+	if cached, _ := renderer.template("page"); cached != page {
+		t.Fatal("expect the watched renderer to keep the template")
+	}
+
+	// the file system may only keep seconds
+	time.Sleep(time.Second)
+	write("layout.jet", `<{{ yield body() }}>`)
+	time.Sleep(100 * time.Millisecond)
+
+	if changed, _ := renderer.template("page"); changed == page {
+		t.Error("expect the template extending the changed layout to be parsed again")
+	}
+
+	if cached, _ := renderer.template("other"); cached != other {
+		t.Error("expect the unrelated template to stay cached")
+	}
+}
+
+func TestRenderer_RenderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "syntax.jet"), []byte("<p>\n{{ if }}\n</p>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "runtime.jet"), []byte("<p>\n{{ missing() }}\n</p>"), 0644)
+
+	renderer := New(false, dir)
+	c := newTestContext(echo.New(), "token")
+
+	for _, test := range []struct {
+		view     string
+		line     int
+		notFound bool
+	}{
+		{"syntax", 2, false},
+		{"runtime", 2, false},
+		{"missing", 0, true},
+	} {
+		err := renderer.Render(ioutil.Discard, test.view, nil, c)
+		templateErr, ok := err.(*TemplateError)
+
+		if !ok {
+			t.Errorf("%s: expect a *TemplateError, got %#v", test.view, err)
+			continue
+		}
+
+		if templateErr.Line != test.line || templateErr.NotFound != test.notFound {
+			t.Errorf("%s: unexpected error %+v", test.view, templateErr)
+		}
+
+		if test.line > 0 && !strings.Contains(templateErr.Source(), "{{") {
+			t.Errorf("%s: expect the snippet of the line, got %q", test.view, templateErr.Source())
+		}
+	}
+}
+
+func BenchmarkRenderer_Render(b *testing.B) {
+	renderer := New(true, "testdata")
+	app := echo.New()
+	data := page{Names: []string{"a", "b", "c"}}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var buf bytes.Buffer
+		c := newTestContext(app, "token")
+
+		for pb.Next() {
+			buf.Reset()
+
+			if err := renderer.Render(&buf, "page.jet", data, c); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
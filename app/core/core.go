@@ -3,6 +3,8 @@ package core
 import (
 	"context"
 	"fmt"
+	"github.com/dulumao/Guten-framework/app/core/adapter/asset"
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
 	"github.com/dulumao/Guten-framework/app/core/adapter/binder"
 	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
 	CoreContext "github.com/dulumao/Guten-framework/app/core/adapter/context"
@@ -33,6 +35,25 @@ func New() *echo.Echo {
 	observer.New()
 	validation.New()
 
+	if env.Value.Auth.Hasher == "argon2id" {
+		auth.SetHasher(auth.NewArgon2idHasher(env.Value.Auth.Argon2id.Memory, env.Value.Auth.Argon2id.Iterations, env.Value.Auth.Argon2id.Parallelism))
+	} else {
+		auth.SetHasher(auth.NewBcryptHasher(env.Value.Auth.Bcrypt.Cost))
+	}
+
+	if env.Value.Auth.RememberLifetime > 0 {
+		auth.DefaultRememberLifetime = time.Duration(env.Value.Auth.RememberLifetime) * time.Second
+	}
+
+	// 0 is not set, a negative value disables throttling
+	if env.Value.Auth.MaxAttempts != 0 {
+		auth.MaxAttempts = env.Value.Auth.MaxAttempts
+	}
+
+	if env.Value.Auth.DecayTime > 0 {
+		auth.DecayTime = time.Duration(env.Value.Auth.DecayTime) * time.Second
+	}
+
 	app := echo.New()
 
 	app.HideBanner = true
@@ -98,6 +119,10 @@ func New() *echo.Echo {
 		store = session.NewFilesystemStore(env.Value.Session.File.Path, []byte(env.Value.Server.HashKey))
 	}
 
+	if env.Value.Session.Driver == "memory" {
+		store = session.NewMemoryStore([]byte(env.Value.Server.HashKey))
+	}
+
 	if env.Value.Session.Driver == "redis" {
 		var err error
 
@@ -139,16 +164,61 @@ func New() *echo.Echo {
 
 	app.Use(session.New(env.Value.Session.Name, store))
 
-	app.Renderer = template.New(false, env.Value.Framework.TemplateDirs...)
+	if env.Value.Framework.AdminPath != "" {
+		var challengePath = env.Value.Auth.TwoFactorPath
+
+		if challengePath == "" {
+			challengePath = strings.TrimRight(env.Value.Framework.AdminPath, "/") + "/two-factor"
+		}
+
+		app.Use(auth.TwoFactor(auth.TwoFactorConfig{
+			PathPrefix:    env.Value.Framework.AdminPath,
+			ChallengePath: challengePath,
+		}))
+	}
+
+	if env.Value.Cache.MetricsPath != "" {
+		app.GET(env.Value.Cache.MetricsPath, cache.MetricsHandler)
+	}
+
+	// namespaces first, "blog::posts/show" is never a file of the template directories
+	loaders := append([]template.ILoader{template.Namespaces, template.NewOSFileSystemLoader(env.Value.Framework.TemplateDirs...)}, template.Loaders...)
+	renderer := template.NewWithLoader(env.Value.Framework.TemplateCached, template.NewChainLoader(loaders...))
+
+	// the preload filter reads the tags before they are minified
+	if env.Value.Framework.TemplateNonce {
+		renderer.Use(template.NonceFilter(env.Value.Framework.TemplateCSP))
+	}
+
+	if env.Value.Framework.TemplatePreload > 0 {
+		renderer.Use(template.PreloadFilter(env.Value.Framework.TemplatePreload))
+	}
+
+	if env.Value.Framework.TemplateMinify {
+		renderer.Use(template.MinifyHTML())
+	}
+
+	// parsed after the filters were added, the nonce filter rewrites the sources
+	if env.Value.Framework.TemplatePrecompile {
+		if err := renderer.Precompile(); err != nil {
+			app.Logger.Fatal(err)
+		}
+	}
+
+	if env.Value.Framework.TemplateWatch > 0 {
+		renderer.Watch(time.Duration(env.Value.Framework.TemplateWatch) * time.Millisecond)
+	}
+
+	app.Renderer = renderer
 	app.Binder = binder.New()
 	app.Validator = validation.Validator
 
 	app.HTTPErrorHandler = func(err error, context echo.Context) {
-		// var code = http.StatusInternalServerError
+		var code = http.StatusInternalServerError
 		var message interface{}
 
 		if http, ok := err.(*echo.HTTPError); ok {
-			// code = http.Code
+			code = http.Code
 			message = http.Message
 
 			if http.Internal != nil {
@@ -164,26 +234,56 @@ func New() *echo.Echo {
 		}
 
 		if !context.Response().Committed {
-			if context.Request().Header.Get("X-Requested-With") == "xmlhttprequest" {
-				context.JSON(http.StatusInternalServerError, map[string]interface{}{
-					"message": message,
-				})
-			} else if context.Request().Method == echo.HEAD { // Issue #608 {
-				err = context.NoContent(http.StatusInternalServerError)
-			} else {
-				err = context.Render(http.StatusOK, "error/fail", map[string]interface{}{
-					"message": message,
-				})
+			var view, data = "error/fail", CoreContext.ErrorData{"message": message}
+
+			// template errors show the failing template instead of the error
+			// view, which may be broken as well
+			if templateErr, ok := err.(*template.TemplateError); ok {
+				view = ""
+
+				if !CoreContext.IsAjax(context) && CoreContext.Negotiate(context.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML, echo.MIMEApplicationJSON) == echo.MIMETextHTML {
+					if env.Value.Server.Debug {
+						err = context.Render(code, "error/panic", map[string]interface{}{
+							"URL":         context.Request().URL.Path,
+							"Err":         templateErr,
+							"Name":        templateErr.Name,
+							"File":        templateErr.File,
+							"Line":        templateErr.Line,
+							"Column":      templateErr.Column,
+							"StartLine":   templateErr.StartLine(),
+							"SourceLines": templateErr.Source(),
+						})
+
+						if err == nil {
+							return
+						}
+					}
+
+					// browsers get the message as text, not the XML they accept
+					context.String(code, fmt.Sprint(message))
+
+					return
+				}
+			}
+
+			if CoreContext.Respond(context, code, view, data) != nil && !context.Response().Committed {
+				context.String(code, fmt.Sprint(message))
 			}
 		}
 	}
 
 	app.Static("/template", "web/assets/template")
 	app.Static("/uploads", "web/assets/uploads")
-	app.Static("/static", "web/assets/static")
+	if err := asset.New(); err != nil {
+		app.Logger.Fatal(err)
+	}
+
+	asset.Static(app)
 
 	echo.NotFoundHandler = func(c echo.Context) error {
-		return c.Render(http.StatusNotFound, "error/not_found", nil)
+		return CoreContext.Respond(c, http.StatusNotFound, "error/not_found", map[string]interface{}{
+			"message": http.StatusText(http.StatusNotFound),
+		})
 	}
 
 	database.New(app)
@@ -11,17 +11,38 @@ type tomlConfig struct {
 	Session   session
 	Database  database
 	Cache     cache
+	Auth      auth
+	Asset     asset
 }
 
 type framework struct {
 	TemplateCached bool     `toml:"template_cached"`
 	TemplateDirs   []string `toml:"template_dirs"`
 	AdminPath      string   `toml:"admin_path"`
+	// TemplatePrecompile parses all templates at boot and stops on errors.
+	TemplatePrecompile bool `toml:"template_precompile"`
+	// TemplateWatch polls the template directories every n milliseconds
+	// when templates are not cached, 0 parses them on every render.
+	TemplateWatch int `toml:"template_watch"`
+	// TemplateMinify removes comments and whitespace from rendered HTML.
+	TemplateMinify bool `toml:"template_minify"`
+	// TemplateNonce adds the CSP nonce of the request to the script and
+	// style tags of the templates, TemplateCSP is sent as
+	// Content-Security-Policy with "{nonce}" replaced, e.g. "script-src
+	// 'self' 'nonce-{nonce}'".
+	TemplateNonce bool   `toml:"template_nonce"`
+	TemplateCSP   string `toml:"template_csp"`
+	// TemplatePreload sends Link preload headers for the stylesheets and
+	// scripts of the pages, at most n of them, 0 disables it.
+	TemplatePreload int `toml:"template_preload"`
 }
 
 type server struct {
-	Debug    bool   `toml:"debug"`
-	Addr     string `toml:"addr"`
+	Debug bool   `toml:"debug"`
+	Addr  string `toml:"addr"`
+	// URL is the public base URL of the application, e.g.
+	// "https://example.com", the links in mails are built from it.
+	URL      string `toml:"url"`
 	Timezone string `toml:"timezone"`
 	LogLevel string `toml:"log_level"`
 	LogFile  string `toml:"log_file"`
@@ -69,6 +90,8 @@ type database struct {
 
 type cache struct {
 	Driver string `toml:"driver"`
+	// MetricsPath serves the cache metrics when set, e.g. "/metrics/cache".
+	MetricsPath string `toml:"metrics_path"`
 
 	Memory struct {
 		Interval int `toml:"interval"`
@@ -91,6 +114,45 @@ type cache struct {
 	Memcache struct {
 		Addr string `toml:"addr"`
 	}
+
+	Tiered struct {
+		Remote   string `toml:"remote"`
+		Size     int    `toml:"size"`
+		LocalTTL int    `toml:"local_ttl"`
+		Channel  string `toml:"channel"`
+	}
+}
+
+type auth struct {
+	Hasher           string `toml:"hasher"`
+	RememberLifetime int    `toml:"remember_lifetime"`
+	// MaxAttempts is the number of failed logins before a lockout. 0 keeps
+	// the default of 5, a negative value disables throttling.
+	MaxAttempts   int    `toml:"max_attempts"`
+	DecayTime     int    `toml:"decay_time"`
+	TwoFactorPath string `toml:"two_factor_path"`
+
+	Bcrypt struct {
+		Cost int `toml:"cost"`
+	}
+
+	Argon2id struct {
+		Memory      uint32 `toml:"memory"`
+		Iterations  uint32 `toml:"iterations"`
+		Parallelism uint8  `toml:"parallelism"`
+	}
+}
+
+type asset struct {
+	// Dir is served under Prefix, "web/assets/static" and "/static" by default.
+	Dir    string `toml:"dir"`
+	Prefix string `toml:"prefix"`
+	// Manifest maps the assets to their fingerprinted files, "manifest.json"
+	// in Dir by default. It is written by assetctl build or by Vite and webpack.
+	Manifest string `toml:"manifest"`
+	// Compress makes assetctl build write gzip variants of the files, brotli
+	// variants are not written.
+	Compress bool `toml:"compress"`
 }
 
 var Value *tomlConfig
@@ -1,7 +1,59 @@
 package view
 
 import (
+	"sync/atomic"
+
 	"github.com/dulumao/Guten-utils/safemap"
 )
 
-var Funcs = safemap.NewSafeMap()
+// FuncMap holds the functions of the templates. It counts its changes, so
+// the renderer copies the functions again only after one.
+type FuncMap struct {
+	version int64
+
+	*safemap.SafeMap
+}
+
+var Funcs = &FuncMap{SafeMap: safemap.NewSafeMap()}
+
+// Version returns the number of changes of the map.
+func (self *FuncMap) Version() int64 {
+	return atomic.LoadInt64(&self.version)
+}
+
+// Set adds or replaces the function k.
+func (self *FuncMap) Set(k interface{}, v interface{}) bool {
+	// SafeMap.Set compares the old value, which panics for functions
+	self.SafeMap.Delete(k)
+	self.SafeMap.Set(k, v)
+	atomic.AddInt64(&self.version, 1)
+
+	return true
+}
+
+func (self *FuncMap) Delete(k interface{}) {
+	self.SafeMap.Delete(k)
+	atomic.AddInt64(&self.version, 1)
+}
+
+func (self *FuncMap) BatchSet(values map[string]string) {
+	self.SafeMap.BatchSet(values)
+	atomic.AddInt64(&self.version, 1)
+}
+
+func (self *FuncMap) BatchRemove(keys []string) {
+	self.SafeMap.BatchRemove(keys)
+	atomic.AddInt64(&self.version, 1)
+}
+
+func (self *FuncMap) GetOrSet(key string, value string) (interface{}, bool) {
+	v, ok := self.SafeMap.GetOrSet(key, value)
+	atomic.AddInt64(&self.version, 1)
+
+	return v, ok
+}
+
+func (self *FuncMap) Clear() {
+	self.SafeMap.Clear()
+	atomic.AddInt64(&self.version, 1)
+}
@@ -58,24 +58,9 @@ func Recover() echo.MiddlewareFunc {
 						err = fmt.Errorf("%v", r)
 					}
 
-					// frames := stack.Callers(0)
-					// frames := stack.Callers(4)
-
-					// depthOfPanic := findPanic()
-					depthOfTemplateError := findTemplateError()
-					skipFrames := 0
-
-					/*if depthOfPanic != 0 {
-						skipFrames = depthOfPanic + 1
-					} else {
-						skipFrames = findTemplateError() + 1
-					}*/
-
-					if depthOfTemplateError != 0 {
-						skipFrames = depthOfTemplateError - 1
-					} else {
-						skipFrames = findPanic() + 1
-					}
+					// template errors are returned by the renderer, panics are
+					// located from the runtime frames
+					skipFrames := findPanic() + 1
 
 					frames := stack.Callers(skipFrames)
 
@@ -93,7 +78,7 @@ func Recover() echo.MiddlewareFunc {
 
 					// c.Error(err)
 					if env.Value.Server.Debug {
-						if c.Request().Header.Get("X-Requested-With") == "xmlhttprequest" {
+						if strings.ToLower(c.Request().Header.Get("X-Requested-With")) == "xmlhttprequest" {
 							c.JSON(http.StatusInternalServerError, map[string]interface{}{
 								"message":  err.Error(),
 								"location": frames[0].String(),
@@ -149,21 +134,3 @@ func findPanic() int {
 
 	return skipNumber
 }
-
-func findTemplateError() int {
-	stack := make([]uintptr, 12)
-	nCallers := runtime.Callers(0, stack)
-	frames := runtime.CallersFrames(stack[:nCallers])
-
-	for i := 0; ; i++ {
-		frame, more := frames.Next()
-		_ = more
-		// Function: (string) (len=42) "github.com/labstack/echo.(*context).Render",
-		if strings.Contains(frame.Function, "github.com/labstack/echo.(*context).Render") {
-			return i
-		} else if !more {
-			// Exhausted the stack, take deepest.
-			return 0
-		}
-	}
-}
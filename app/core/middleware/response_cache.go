@@ -0,0 +1,507 @@
+package middleware
+
+import (
+	"bytes"
+	stdContext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/adapter/template"
+	"github.com/dulumao/Guten-framework/app/core/env"
+	"github.com/dulumao/Guten-utils/conv"
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+const (
+	// responseTagsKey is the context key of the tags added with CacheTags.
+	responseTagsKey = "response_cache_tags"
+
+	headerCacheControl = "Cache-Control"
+	headerETag         = "ETag"
+	headerIfNoneMatch  = "If-None-Match"
+)
+
+type (
+	// ResponseCacheConfig defines the config for ResponseCache middleware.
+	ResponseCacheConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// TTL of cached responses without max-age or s-maxage.
+		// Optional. Default value 1 minute.
+		TTL time.Duration
+
+		// Headers of the request that are part of the key, e.g. Accept-Language.
+		// Optional. Default value [Accept].
+		Headers []string
+
+		// VaryBySession caches a response per session, so pages with flashes
+		// can be cached. Without it requests with a session cookie are not
+		// cached, unless VaryByAuth is set and the user is logged in. Pages
+		// showing the csrf token are never cached.
+		// Optional. Default value false.
+		VaryBySession bool
+
+		// SessionCookie is the name of the session cookie.
+		// Optional. Default value the session name of env.toml.
+		SessionCookie string
+
+		// VaryByAuth caches a response per logged in user of the default guard.
+		// Without it requests with an Authorization header are not cached.
+		// Optional. Default value false.
+		VaryByAuth bool
+
+		// Tags returns the tags of the responses of the request, handlers can
+		// add more with CacheTags. InvalidateResponses drops them by tag.
+		// Optional.
+		Tags func(c echo.Context) []string
+	}
+
+	cachedResponse struct {
+		Status       int
+		Header       http.Header
+		Body         []byte
+		ETag         string
+		LastModified int64
+		Tags         map[string]string
+	}
+
+	// bufferWriter holds back the response until it is known to be cacheable.
+	bufferWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+var (
+	// DefaultResponseCacheConfig is the default ResponseCache middleware config.
+	DefaultResponseCacheConfig = ResponseCacheConfig{
+		Skipper: middleware.DefaultSkipper,
+		TTL:     time.Minute,
+		Headers: []string{echo.HeaderAccept},
+	}
+)
+
+func (self *bufferWriter) WriteHeader(status int) {
+	self.status = status
+}
+
+func (self *bufferWriter) Write(b []byte) (int, error) {
+	return self.body.Write(b)
+}
+
+// Flush is a no-op, the response is sent once the handler returned.
+func (self *bufferWriter) Flush() {}
+
+// CacheTags adds tags to the response of the request, for ResponseCache.
+func CacheTags(c echo.Context, tags ...string) {
+	existing, _ := c.Get(responseTagsKey).([]string)
+	c.Set(responseTagsKey, append(existing, tags...))
+}
+
+// InvalidateResponses drops the cached responses with any of the tags.
+func InvalidateResponses(ctx stdContext.Context, tags ...string) error {
+	if cache.Store == nil {
+		return nil
+	}
+
+	return cache.Store.Tags(tags...).Flush(ctx)
+}
+
+// ResponseCache returns a middleware that caches GET responses.
+func ResponseCache() echo.MiddlewareFunc {
+	return ResponseCacheWithConfig(DefaultResponseCacheConfig)
+}
+
+// ResponseCacheWithConfig returns a ResponseCache middleware with config.
+//
+// Responses are cached by method, path, query and the configured request
+// headers. Requests with Cache-Control no-store skip the cache, no-cache
+// skips the cached copy, as do requests with a session cookie or an
+// Authorization header unless the config varies by them. Responses are
+// stored only with status 200, no new cookies, no CSP nonce, no csrf token
+// read with template.CSRFToken, no Vary on headers other than the
+// configured ones and no Cache-Control no-store, no-cache or private (the
+// last is allowed when varying by session or user). Vary: Cookie, which the
+// CSRF middleware adds, has to be configured even if it was set before the
+// cache, so routes cached without Cookie in Headers skip the CSRF
+// middleware. Cached responses carry an ETag and Last-Modified, matching
+// conditional requests get a 304.
+func ResponseCacheWithConfig(config ResponseCacheConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultResponseCacheConfig.Skipper
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultResponseCacheConfig.TTL
+	}
+	if config.Headers == nil {
+		config.Headers = DefaultResponseCacheConfig.Headers
+	}
+	if config.SessionCookie == "" && env.Value != nil {
+		config.SessionCookie = env.Value.Session.Name
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			if config.Skipper(c) || cache.Store == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return next(c)
+			}
+
+			requestControl := parseCacheControl(req.Header.Get(headerCacheControl))
+
+			if _, ok := requestControl["no-store"]; ok || !varyCovers(c, config) {
+				return next(c)
+			}
+
+			ctx := req.Context()
+			key := responseCacheKey(c, config)
+
+			if _, ok := requestControl["no-cache"]; !ok {
+				var cached cachedResponse
+
+				if err := cache.Store.Get(ctx, key, &cached); err == nil && tagsCurrent(ctx, cached.Tags) {
+					return writeCachedResponse(c, &cached, "HIT")
+				}
+			}
+
+			res := c.Response()
+			cookies := len(res.Header()[echo.HeaderSetCookie])
+			vary := len(res.Header()[echo.HeaderVary])
+			writer := &bufferWriter{ResponseWriter: res.Writer, status: http.StatusOK}
+			res.Writer = writer
+
+			err := next(c)
+
+			// nothing was sent yet, the response is written below or by the
+			// error handler
+			res.Writer = writer.ResponseWriter
+			res.Committed = false
+
+			if err != nil {
+				return err
+			}
+
+			cached := &cachedResponse{
+				Status: writer.status,
+				Header: res.Header(),
+				Body:   writer.body.Bytes(),
+			}
+
+			ttl, cacheable := responseTTL(res.Header(), config)
+
+			if cached.Status != http.StatusOK || len(res.Header()[echo.HeaderSetCookie]) != cookies {
+				cacheable = false
+			}
+
+			// a CSP nonce or csrf token must not be sent to other visitors
+			if c.Get(template.NonceKey) != nil || c.Get(template.CSRFReadKey) != nil {
+				cacheable = false
+			}
+
+			// the key only varies by the configured headers. Cookie is never
+			// covered by the session, whoever added it, e.g. the CSRF middleware.
+			for i, value := range res.Header()[echo.HeaderVary] {
+				if (i >= vary || varyCookie(value)) && !headersCover(config.Headers, value) {
+					cacheable = false
+				}
+			}
+
+			if !cacheable {
+				res.WriteHeader(cached.Status)
+				_, err = res.Write(cached.Body)
+				return err
+			}
+
+			sum := sha256.Sum256(cached.Body)
+			cached.ETag = `W/"` + hex.EncodeToString(sum[:16]) + `"`
+			cached.LastModified = time.Now().Unix()
+			cached.Header = storableHeader(res.Header())
+
+			var tags []string
+
+			if config.Tags != nil {
+				tags = append(tags, config.Tags(c)...)
+			}
+
+			if extra, ok := c.Get(responseTagsKey).([]string); ok {
+				tags = append(tags, extra...)
+			}
+
+			if len(tags) > 0 {
+				if cached.Tags, err = cache.Store.TagVersions(ctx, tags...); err != nil {
+					cached.Tags = nil
+					cacheable = false
+				}
+			}
+
+			if cacheable {
+				cache.Store.Set(ctx, key, cached, ttl)
+			}
+
+			return writeCachedResponse(c, cached, "MISS")
+		}
+	}
+}
+
+func responseCacheKey(c echo.Context, config ResponseCacheConfig) string {
+	req := c.Request()
+	query := req.URL.Query()
+
+	var keys = make([]string, 0, len(query))
+
+	for name := range query {
+		keys = append(keys, name)
+	}
+
+	sort.Strings(keys)
+
+	var parts = []string{req.Method, req.URL.Path}
+
+	for _, name := range keys {
+		values := query[name]
+		sort.Strings(values)
+		parts = append(parts, name+"="+strings.Join(values, ","))
+	}
+
+	for _, name := range config.Headers {
+		parts = append(parts, name+":"+req.Header.Get(name))
+	}
+
+	if config.VaryBySession && config.SessionCookie != "" {
+		var cookie string
+
+		if k, err := c.Cookie(config.SessionCookie); err == nil {
+			cookie = k.Value
+		}
+
+		parts = append(parts, "session:"+cookie)
+	}
+
+	if config.VaryByAuth {
+		if manager := auth.Default(c); manager.Guard() != nil {
+			parts = append(parts, "user:"+conv.String(manager.ID()))
+		}
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+
+	return "response:" + hex.EncodeToString(sum[:])
+}
+
+// varyCovers reports whether the session cookie and Authorization header
+// of the request, if any, are part of the key. With only VaryByAuth a
+// session cookie is covered for logged in users, not for guests.
+func varyCovers(c echo.Context, config ResponseCacheConfig) bool {
+	if c.Request().Header.Get(echo.HeaderAuthorization) != "" && !config.VaryByAuth {
+		return false
+	}
+
+	if config.SessionCookie != "" && !config.VaryBySession {
+		if _, err := c.Cookie(config.SessionCookie); err == nil {
+			// all guests share the user part of the key, not their sessions
+			if !config.VaryByAuth || auth.Default(c).ID() == nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// varyCookie reports whether a Vary value names the Cookie header.
+func varyCookie(vary string) bool {
+	for _, name := range strings.Split(vary, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), echo.HeaderCookie) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headersCover reports whether the headers of a Vary value are all in headers.
+func headersCover(headers []string, vary string) bool {
+	for _, name := range strings.Split(vary, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		var found bool
+
+		for _, header := range headers {
+			if strings.EqualFold(header, name) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// responseTTL reads the Cache-Control of the response.
+func responseTTL(header http.Header, config ResponseCacheConfig) (time.Duration, bool) {
+	control := parseCacheControl(header.Get(headerCacheControl))
+
+	if _, ok := control["no-store"]; ok {
+		return 0, false
+	}
+
+	if _, ok := control["no-cache"]; ok {
+		return 0, false
+	}
+
+	if _, ok := control["private"]; ok && !config.VaryBySession && !config.VaryByAuth {
+		return 0, false
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := control[name]; ok {
+			seconds, err := strconv.Atoi(value)
+
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return config.TTL, true
+}
+
+func parseCacheControl(value string) map[string]string {
+	var directives = make(map[string]string)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		name := strings.ToLower(kv[0])
+
+		if len(kv) == 2 {
+			directives[name] = strings.Trim(kv[1], `"`)
+		} else {
+			directives[name] = ""
+		}
+	}
+
+	return directives
+}
+
+// storableHeader leaves out the headers that belong to one response only.
+func storableHeader(header http.Header) http.Header {
+	var stored = make(http.Header)
+
+	for name, values := range header {
+		switch name {
+		case echo.HeaderSetCookie, echo.HeaderXRequestID, echo.HeaderContentLength, "X-Cache":
+			continue
+		}
+
+		stored[name] = values
+	}
+
+	return stored
+}
+
+func tagsCurrent(ctx stdContext.Context, tags map[string]string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+
+	var names = make([]string, 0, len(tags))
+
+	for name := range tags {
+		names = append(names, name)
+	}
+
+	current, err := cache.Store.TagVersions(ctx, names...)
+
+	if err != nil {
+		return false
+	}
+
+	for name, version := range tags {
+		if current[name] != version {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeCachedResponse(c echo.Context, cached *cachedResponse, status string) error {
+	res := c.Response()
+	req := c.Request()
+	header := res.Header()
+
+	for name, values := range cached.Header {
+		if _, ok := header[name]; !ok {
+			header[name] = values
+		}
+	}
+
+	lastModified := time.Unix(cached.LastModified, 0).UTC()
+	header.Set("X-Cache", status)
+	header.Set(headerETag, cached.ETag)
+	header.Set(echo.HeaderLastModified, lastModified.Format(http.TimeFormat))
+
+	if notModified(req, cached.ETag, lastModified) {
+		header.Del(echo.HeaderContentType)
+		header.Del(echo.HeaderContentLength)
+
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	if req.Method == http.MethodHead {
+		return c.NoContent(cached.Status)
+	}
+
+	res.WriteHeader(cached.Status)
+	_, err := res.Write(cached.Body)
+
+	return err
+}
+
+func notModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if match := req.Header.Get(headerIfNoneMatch); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if since, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince)); err == nil {
+		return !lastModified.After(since)
+	}
+
+	return false
+}
@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	stdContext "context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dulumao/Guten-framework/app/core/adapter/auth"
+	"github.com/dulumao/Guten-framework/app/core/adapter/cache"
+	"github.com/dulumao/Guten-framework/app/core/adapter/template"
+	utilsCache "github.com/dulumao/Guten-utils/os/cache"
+	"github.com/labstack/echo"
+)
+
+func TestResponseCache(t *testing.T) {
+	adapter, _ := utilsCache.NewCache("memory", `{"interval":0}`)
+	cache.Store = cache.NewRepository(adapter, cache.JSON)
+	defer func() { cache.Store = nil }()
+
+	var calls int
+
+	app := echo.New()
+	app.Use(ResponseCacheWithConfig(ResponseCacheConfig{}))
+	app.GET("/posts", func(c echo.Context) error {
+		calls++
+		CacheTags(c, "posts")
+		return c.String(http.StatusOK, "posts")
+	})
+	app.GET("/private", func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("Cache-Control", "no-store")
+		return c.String(http.StatusOK, "private")
+	})
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	first := get("/posts")
+	second := get("/posts")
+
+	if calls != 1 || second.Body.String() != "posts" || second.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("expect a cached response, got %d calls, %q", calls, second.Body.String())
+	}
+
+	if rec := get("/posts", "If-None-Match", first.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("expect 304 for a matching ETag, got %d", rec.Code)
+	}
+
+	InvalidateResponses(stdContext.Background(), "posts")
+
+	if get("/posts"); calls != 2 {
+		t.Errorf("expect the invalidated response to be rendered again, got %d calls", calls)
+	}
+
+	get("/private")
+	get("/private")
+
+	if calls != 4 {
+		t.Errorf("expect no-store responses not to be cached, got %d calls", calls)
+	}
+}
+
+func TestResponseCache_Private(t *testing.T) {
+	adapter, _ := utilsCache.NewCache("memory", `{"interval":0}`)
+	cache.Store = cache.NewRepository(adapter, cache.JSON)
+	defer func() { cache.Store = nil }()
+
+	var calls int
+
+	app := echo.New()
+	app.Use(ResponseCacheWithConfig(ResponseCacheConfig{SessionCookie: "session"}))
+	app.GET("/", func(c echo.Context) error {
+		calls++
+
+		if _, err := c.Cookie("session"); err == nil {
+			return c.String(http.StatusOK, "hello user")
+		}
+
+		return c.String(http.StatusOK, "hello guest")
+	})
+	app.GET("/language", func(c echo.Context) error {
+		calls++
+		c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+		c.Response().Flush()
+		return c.String(http.StatusOK, "hello")
+	})
+	app.GET("/nonce", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, template.CSPNonce(c))
+	})
+
+	get := func(path string, header ...string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		return rec.Body.String()
+	}
+
+	get("/")
+
+	if body := get("/", "Cookie", "session=abc"); body != "hello user" {
+		t.Errorf("expect the logged in user not to get the cached page, got %q", body)
+	}
+
+	if get("/", "Authorization", "Bearer token"); calls != 3 {
+		t.Errorf("expect requests with an Authorization header not to be cached, got %d calls", calls)
+	}
+
+	if body := get("/"); body != "hello guest" || calls != 3 {
+		t.Errorf("expect the guest page to be cached, got %q, %d calls", body, calls)
+	}
+
+	get("/language")
+	get("/language")
+
+	if calls != 5 {
+		t.Errorf("expect responses varying by other headers not to be cached, got %d calls", calls)
+	}
+
+	if get("/nonce") == get("/nonce") || calls != 7 {
+		t.Errorf("expect responses with a CSP nonce not to be cached, got %d calls", calls)
+	}
+}
+
+func TestResponseCache_CSRF(t *testing.T) {
+	adapter, _ := utilsCache.NewCache("memory", `{"interval":0}`)
+	cache.Store = cache.NewRepository(adapter, cache.JSON)
+	defer func() { cache.Store = nil }()
+
+	var calls int
+
+	app := echo.New()
+	app.Use(CSRF())
+	app.Use(ResponseCacheWithConfig(ResponseCacheConfig{SessionCookie: "session"}))
+	app.GET("/form", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, template.CSRFToken(c))
+	})
+	app.GET("/about", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, "about")
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return rec
+	}
+
+	first, second := get("/form"), get("/form")
+
+	if first.Body.String() == second.Body.String() || calls != 2 {
+		t.Errorf("expect every visitor to get their own csrf token, got %q twice, %d calls", first.Body.String(), calls)
+	}
+
+	if cookie := second.Result().Cookies(); len(cookie) != 1 || cookie[0].Value != second.Body.String() {
+		t.Errorf("expect the token of the page to match the cookie, got %v", cookie)
+	}
+
+	// Vary: Cookie of the CSRF middleware is not covered by the key
+	get("/about")
+	get("/about")
+
+	if calls != 4 {
+		t.Errorf("expect responses varying by Cookie not to be cached, got %d calls", calls)
+	}
+
+	// the token is not stored even without the Vary of the middleware
+	app = echo.New()
+	app.Use(ResponseCacheWithConfig(ResponseCacheConfig{SessionCookie: "session"}))
+	app.GET("/form", func(c echo.Context) error {
+		calls++
+		c.Set("csrf", "token")
+		return c.String(http.StatusOK, template.CSRFToken(c))
+	})
+
+	get("/form")
+	get("/form")
+
+	if calls != 6 {
+		t.Errorf("expect pages with a csrf token not to be cached, got %d calls", calls)
+	}
+}
+
+func TestResponseCache_VaryByAuthGuest(t *testing.T) {
+	adapter, _ := utilsCache.NewCache("memory", `{"interval":0}`)
+	cache.Store = cache.NewRepository(adapter, cache.JSON)
+	defer func() { cache.Store = nil }()
+
+	auth.RegisterGuard("response_cache_test", func(name string, c echo.Context) auth.IGuard {
+		return auth.NewTokenGuard(name, nil, c)
+	})
+	auth.SetDefaultGuard("response_cache_test")
+	defer auth.SetDefaultGuard("web")
+
+	var calls int
+
+	app := echo.New()
+	app.Use(ResponseCacheWithConfig(ResponseCacheConfig{SessionCookie: "session", VaryByAuth: true}))
+	app.GET("/", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, "hello")
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Cookie", "session=abc")
+		app.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if calls != 2 {
+		t.Errorf("expect guests with a session not to share the cache, got %d calls", calls)
+	}
+}
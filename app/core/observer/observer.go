@@ -1,11 +1,92 @@
 package observer
 
 import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/dulumao/Guten-utils/os/event"
 )
 
 var Dispatcher event.Dispatcher
 
+type wildcardListener struct {
+	pattern  string
+	listener event.Listener
+}
+
+var wildcards = struct {
+	sync.RWMutex
+	listeners []wildcardListener
+}{}
+
+func init() {
+	Dispatcher = event.New()
+}
+
 func New() {
 	Dispatcher = event.New()
+
+	wildcards.Lock()
+	wildcards.listeners = nil
+	wildcards.Unlock()
+}
+
+// On adds a listener of the event. Patterns with "*" listen to every event
+// they match, e.g. "view.after.admin.*" to the views below admin.
+//
+// Wildcard listeners run after all listeners of the exact name, whatever
+// their Priority, which only orders the listeners within each group.
+func On(pattern string, listener event.Listener) {
+	if !strings.Contains(pattern, "*") {
+		Dispatcher.On(pattern, listener)
+		return
+	}
+
+	wildcards.Lock()
+	defer wildcards.Unlock()
+
+	// Emit iterates the old slice without the lock
+	var listeners = append(append([]wildcardListener{}, wildcards.listeners...), wildcardListener{pattern: pattern, listener: listener})
+
+	sort.SliceStable(listeners, func(i, j int) bool {
+		return listeners[i].listener.Priority < listeners[j].listener.Priority
+	})
+
+	wildcards.listeners = listeners
+}
+
+// Emit notifies the listeners of the event, then the wildcard listeners
+// matching it. The first error stops the notification.
+func Emit(name string, data interface{}) error {
+	if err := Dispatcher.Emit(name, data); err != nil {
+		return err
+	}
+
+	wildcards.RLock()
+	var listeners = wildcards.listeners
+	wildcards.RUnlock()
+
+	for _, wildcard := range listeners {
+		if Match(wildcard.pattern, name) {
+			if err := wildcard.listener.Callback(&event.Event{Name: name, Data: data}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether the event name matches the pattern, a trailing "*"
+// matches the rest of the name, other patterns are matched with path.Match.
+func Match(pattern, name string) bool {
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern && !strings.ContainsAny(prefix, "*?[") {
+		return strings.HasPrefix(name, prefix)
+	}
+
+	ok, _ := path.Match(pattern, name)
+
+	return ok
 }